@@ -0,0 +1,362 @@
+package menuify
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IsArchive returns true if a file name looks like an archive OpenArchive can browse
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive opens a zip or tar archive within a filesystem as a read-only filesystem of its own
+// Tar archives are indexed up front and read through again to reach a file once it's opened, so their data is never held in memory
+// The returned filesystem is an io.Closer, closing it lets go of the archive's open file until it's read again
+func OpenArchive(fsys fs.FS, name string) (fs.FS, error) {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") {
+		return openZip(fsys, name)
+	}
+	if !strings.HasSuffix(lower, ".tar") && !strings.HasSuffix(lower, ".tar.gz") && !strings.HasSuffix(lower, ".tgz") {
+		return nil, fmt.Errorf("not an archive: %s", name)
+	}
+
+	tr, f, err := openTar(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	archive := &tarFS{fsys: fsys, name: name, files: map[string]*tarEntry{".": {name: ".", mode: fs.ModeDir | 0555, index: -1}}}
+	for index := 0; ; index++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			archive.addDir(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			archive.addFile(hdr.Name, hdr.Size, hdr.FileInfo().Mode(), hdr.ModTime, index)
+		}
+	}
+	return archive, nil
+}
+
+// zipFS is a zip archive read through a reopener, so it can be closed
+type zipFS struct {
+	*zip.Reader
+	file *reopener //nil if the archive was read into memory
+}
+
+func openZip(fsys fs.FS, name string) (fs.FS, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, ok := f.(io.ReaderAt); !ok {
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), info.Size())
+		if err != nil {
+			return nil, err
+		}
+		return &zipFS{Reader: zr}, nil
+	}
+
+	file := &reopener{fsys: fsys, name: name, f: f}
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &zipFS{Reader: zr, file: file}, nil
+}
+
+func (z *zipFS) Close() error {
+	if z.file == nil {
+		return nil
+	}
+	return z.file.Close()
+}
+
+// reopener reads a file at offsets, opening it again if it was closed since
+type reopener struct {
+	fsys fs.FS
+	name string
+	mu   sync.Mutex
+	f    fs.File
+}
+
+func (ro *reopener) ReadAt(p []byte, off int64) (int, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	if ro.f == nil {
+		f, err := ro.fsys.Open(ro.name)
+		if err != nil {
+			return 0, err
+		}
+		ro.f = f
+	}
+	readerAt, ok := ro.f.(io.ReaderAt)
+	if !ok {
+		return 0, fmt.Errorf("can't read %s at an offset", ro.name)
+	}
+	return readerAt.ReadAt(p, off)
+}
+
+func (ro *reopener) Close() error {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	if ro.f == nil {
+		return nil
+	}
+	err := ro.f.Close()
+	ro.f = nil
+	return err
+}
+
+// openTar opens a tar archive for reading through from the start, decompressing it if its name says so
+func openTar(fsys fs.FS, name string) (*tar.Reader, io.Closer, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(gz), f, nil
+	}
+
+	var r io.Reader = f
+	if readerAt, ok := f.(io.ReaderAt); ok {
+		if info, err := f.Stat(); err == nil {
+			r = io.NewSectionReader(readerAt, 0, info.Size()) //lets the data of skipped files be seeked past
+		}
+	}
+	return tar.NewReader(r), f, nil
+}
+
+// tarFS is a read-only filesystem indexing the files of a tar archive
+type tarFS struct {
+	fsys  fs.FS
+	name  string
+	files map[string]*tarEntry
+
+	mu   sync.Mutex
+	idle *tarCursor //left by the last file closed, so opening a file further on carries on reading from there
+}
+
+type tarEntry struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	index   int //how many entries come before it in the archive, or -1 for directories
+}
+
+// tarCursor is a position in an archive being read through
+type tarCursor struct {
+	tr   *tar.Reader
+	f    io.Closer
+	next int //the index of the entry tr.Next returns
+}
+
+func (t *tarFS) addDir(name string, mode fs.FileMode, modTime time.Time) {
+	name = fsPath(name)
+	if name == "." {
+		return
+	}
+	t.addDir(path.Dir(name), fs.ModeDir|0555, modTime)
+	if _, ok := t.files[name]; !ok {
+		t.files[name] = &tarEntry{name: path.Base(name), mode: mode | fs.ModeDir, modTime: modTime, index: -1}
+	}
+}
+
+func (t *tarFS) addFile(name string, size int64, mode fs.FileMode, modTime time.Time, index int) {
+	name = fsPath(name)
+	t.addDir(path.Dir(name), fs.ModeDir|0555, modTime)
+	t.files[name] = &tarEntry{name: path.Base(name), size: size, mode: mode, modTime: modTime, index: index}
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	info, err := t.Stat(name)
+	if err != nil {
+		err.(*fs.PathError).Op = "open"
+		return nil, err
+	}
+	entry := info.(*tarEntry)
+	if entry.IsDir() {
+		return &tarFile{fsys: t, path: name, entry: entry}, nil
+	}
+
+	t.mu.Lock()
+	cur := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+	if cur != nil && cur.next > entry.index {
+		cur.f.Close()
+		cur = nil
+	}
+	if cur == nil {
+		tr, f, err := openTar(t.fsys, t.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		cur = &tarCursor{tr: tr, f: f}
+	}
+	for cur.next <= entry.index {
+		if _, err := cur.tr.Next(); err != nil {
+			cur.f.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF //the archive changed since it was indexed
+			}
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		cur.next++
+	}
+	return &tarFile{fsys: t, path: name, entry: entry, cur: cur}, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !dir.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, 0)
+	for filePath, file := range t.files {
+		if filePath != "." && path.Dir(filePath) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(file))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Close lets go of the archive file kept for reading on from the last file closed
+func (t *tarFS) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.idle == nil {
+		return nil
+	}
+	err := t.idle.f.Close()
+	t.idle = nil
+	return err
+}
+
+func (te *tarEntry) Name() string       { return te.name }
+func (te *tarEntry) Size() int64        { return te.size }
+func (te *tarEntry) Mode() fs.FileMode  { return te.mode }
+func (te *tarEntry) ModTime() time.Time { return te.modTime }
+func (te *tarEntry) IsDir() bool        { return te.mode.IsDir() }
+func (te *tarEntry) Sys() interface{}   { return nil }
+
+// tarFile is an open file in a tarFS, reading its data straight out of the archive
+type tarFile struct {
+	fsys  *tarFS
+	path  string
+	entry *tarEntry
+	cur   *tarCursor    //nil for directories and once closed
+	dir   []fs.DirEntry //the entries of a directory left for ReadDir
+	read  bool          //ReadDir listed the directory already
+}
+
+func (tf *tarFile) Stat() (fs.FileInfo, error) { return tf.entry, nil }
+
+func (tf *tarFile) Read(p []byte) (int, error) {
+	if tf.cur == nil {
+		if tf.entry.IsDir() {
+			return 0, &fs.PathError{Op: "read", Path: tf.entry.name, Err: fmt.Errorf("is a directory")}
+		}
+		return 0, fs.ErrClosed
+	}
+	return tf.cur.tr.Read(p)
+}
+
+func (tf *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !tf.read {
+		entries, err := tf.fsys.ReadDir(tf.path)
+		if err != nil {
+			return nil, err
+		}
+		tf.dir, tf.read = entries, true
+	}
+	if n <= 0 {
+		entries := tf.dir
+		tf.dir = nil
+		return entries, nil
+	}
+	if len(tf.dir) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(tf.dir) {
+		n = len(tf.dir)
+	}
+	entries := tf.dir[:n]
+	tf.dir = tf.dir[n:]
+	return entries, nil
+}
+
+func (tf *tarFile) Close() error {
+	if tf.cur == nil {
+		return nil
+	}
+	tf.fsys.mu.Lock()
+	defer tf.fsys.mu.Unlock()
+	if tf.fsys.idle != nil {
+		tf.fsys.idle.f.Close()
+	}
+	tf.fsys.idle = tf.cur
+	tf.cur = nil
+	return nil
+}
@@ -0,0 +1,135 @@
+package menuify
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var archiveFiles = []struct{ name, data string }{
+	{"a.txt", "first"},
+	{"dir/b.txt", "second"},
+	{"dir/sub/c.txt", "third"},
+}
+
+func tarData(t *testing.T, gz bool) []byte {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(buf)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755})
+	for _, file := range archiveFiles {
+		tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: file.name, Mode: 0644, Size: int64(len(file.data))})
+		tw.Write([]byte(file.data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		zw.Close()
+	}
+	return buf.Bytes()
+}
+
+func zipData(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, file := range archiveFiles {
+		w, _ := zw.Create(file.name)
+		w.Write([]byte(file.data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func archiveFS(t *testing.T) fstest.MapFS {
+	return fstest.MapFS{
+		"files.tar":    {Data: tarData(t, false)},
+		"files.tar.gz": {Data: tarData(t, true)},
+		"files.zip":    {Data: zipData(t)},
+		"notes.txt":    {Data: []byte("not an archive")},
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	fsys := archiveFS(t)
+	for _, name := range []string{"files.tar", "files.tar.gz", "files.zip"} {
+		t.Run(name, func(t *testing.T) {
+			archive, err := OpenArchive(fsys, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.(io.Closer).Close()
+			if err := fstest.TestFS(archive, "a.txt", "dir/b.txt", "dir/sub/c.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			//Reading backwards through the archive and after closing it both have to start over
+			for _, i := range []int{2, 0, 1} {
+				if i == 1 {
+					archive.(io.Closer).Close()
+				}
+				data, err := fs.ReadFile(archive, archiveFiles[i].name)
+				if err != nil || string(data) != archiveFiles[i].data {
+					t.Errorf("read %s as %q, %v", archiveFiles[i].name, data, err)
+				}
+			}
+		})
+	}
+
+	if _, err := OpenArchive(fsys, "notes.txt"); err == nil {
+		t.Error("opened a text file as an archive")
+	}
+}
+
+func TestTarKeepsNoData(t *testing.T) {
+	archive, err := OpenArchive(archiveFS(t), "files.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, entry := range archive.(*tarFS).files {
+		if !entry.IsDir() && entry.index < 0 {
+			t.Errorf("%s has no place in the archive", name)
+		}
+	}
+	if info, err := fs.Stat(archive, "dir/sub/c.txt"); err != nil || info.Size() != int64(len("third")) {
+		t.Errorf("stat %v, %v", info, err)
+	}
+}
+
+func TestArchivesDroppedOnLeave(t *testing.T) {
+	me := newExplorerEngine()
+	me.Filesystems["arc"] = archiveFS(t)
+	me.ExplorerWith("arc:/", "", &ExplorerOptions{Archives: true})
+	pick(t, me, "files.zip")
+	if !strings.HasSuffix(me.Menus[me.LoadedMenu].explorer.location, "files.zip!/") {
+		t.Fatalf("not browsing the archive: %s", me.Menus[me.LoadedMenu].explorer.location)
+	}
+	pick(t, me, "dir/")
+	if len(me.archives) != 1 {
+		t.Fatalf("%d archives open", len(me.archives))
+	}
+
+	me.PrevMenu()
+	if len(me.archives) != 1 {
+		t.Error("archive dropped while still browsing it")
+	}
+	for me.LoadedMenu != "home" {
+		me.PrevMenu()
+	}
+	if me.archives != nil {
+		t.Errorf("%d archives left open", len(me.archives))
+	}
+}
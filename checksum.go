@@ -0,0 +1,187 @@
+package menuify
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+var (
+	// ChecksumAlgos lists the supported checksum algorithms, in the order sibling checksum files are looked for
+	ChecksumAlgos = []string{"sha256", "sha1", "md5"}
+)
+
+// newHash returns a hash for a checksum algorithm and its display name
+func newHash(algo string) (hash.Hash, string, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), "SHA-256", nil
+	case "sha1":
+		return sha1.New(), "SHA-1", nil
+	case "md5":
+		return md5.New(), "MD5", nil
+	}
+	return nil, "", fmt.Errorf("unknown checksum algorithm: %s", algo)
+}
+
+// Checksum computes a file's checksum in the background with progress, then shows whether it matches with menuID "INTERNAL_CHECKSUM"
+// An empty algo picks one by the length of the expected value, or by the sibling checksum file found, such as file.sha256 or file.md5, defaulting to sha256
+// The expected value is read from the variable expectedVar if it's set, otherwise from the sibling checksum file
+// The result is stored in CHECKSUM, CHECKSUM_ALGO and CHECKSUM_MATCH, which is true, false or empty if there was nothing to compare against
+func (me *MenuEngine) Checksum(location, algo, expectedVar string) {
+	prefix, file := me.splitLocation(location)
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		me.ErrorText("Failed to open "+location, err.Error())
+		return
+	}
+
+	expected, source := "", ""
+	if expectedVar != "" {
+		expected, _ = me.GetVar(expectedVar)
+		source = "the variable " + expectedVar
+	}
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if expected == "" {
+		expected, algo, source = siblingChecksum(fsys, fsPath(file), algo)
+		expected = strings.ToLower(strings.TrimSpace(expected))
+	} else if algo == "" {
+		algo = checksumAlgo(expected)
+	}
+	if algo == "" {
+		algo = "sha256"
+	}
+	h, algoName, err := newHash(algo)
+	if err != nil {
+		me.ErrorText(err.Error(), location)
+		return
+	}
+
+	result := &MenuItemList{
+		Title: "Checksum - " + escapeVars(path.Base(file)),
+	}
+	me.AddMenu("INTERNAL_CHECKSUM", result)
+
+	op := me.RunTask(algoName+" of "+escapeVars(path.Base(file)), func(progress *Progress, log io.Writer) error {
+		sum, err := hashFile(fsys, fsPath(file), h, progress)
+
+		match, title, subtitle := "", "", ""
+		switch {
+		case err != nil:
+			title = "Checksum failed"
+			subtitle = fmt.Sprintf("Failed to read %s: %v", location, err)
+		case expected == "":
+			title = algoName + " computed"
+			subtitle = fmt.Sprintf("%s\n\n%s\n\nThere's no checksum to compare against", location, sum)
+		case sum == expected:
+			match = "true"
+			title = "PASS - checksum matches"
+			subtitle = fmt.Sprintf("%s of %s\n\n%s\n\nmatches %s", algoName, location, sum, source)
+		default:
+			match = "false"
+			title = "FAIL - checksum does not match"
+			subtitle = fmt.Sprintf("%s of %s\n\n%s\n\ndoesn't match the expected value from %s\n\n%s", algoName, location, sum, source, expected)
+		}
+		me.Do(func() {
+			result.Title = title
+			result.Subtitle = escapeVars(subtitle)
+			if err == nil {
+				me.SetVar("CHECKSUM", sum)
+				me.SetVar("CHECKSUM_ALGO", algo)
+				me.SetVar("CHECKSUM_MATCH", match)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(log, sum)
+		if match == "false" {
+			return fmt.Errorf("checksum mismatch")
+		}
+		return nil
+	})
+	op.Opts = &ExecOptions{OnSuccess: "INTERNAL_CHECKSUM", OnFailure: "INTERNAL_CHECKSUM"}
+}
+
+// checksumAlgo returns the algorithm a hex checksum was made with going by its length, or an empty string if it doesn't match one
+func checksumAlgo(sum string) string {
+	switch len(sum) {
+	case sha256.Size * 2:
+		return "sha256"
+	case sha1.Size * 2:
+		return "sha1"
+	case md5.Size * 2:
+		return "md5"
+	}
+	return ""
+}
+
+// hashFile hashes a file, reporting progress against its size
+func hashFile(fsys fs.FS, name string, h hash.Hash, progress *Progress) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var done int64
+	progress.SetStatus("Reading " + path.Base(name))
+	if _, err := io.Copy(h, &progressReader{r: f, progress: progress, done: &done, total: info.Size()}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// siblingChecksum looks for a checksum file next to a file, such as file.sha256 or file.md5sum, returning the checksum, its algorithm and the file it came from
+// If algo isn't empty, only checksum files for that algorithm are looked for
+func siblingChecksum(fsys fs.FS, name, algo string) (string, string, string) {
+	for _, candidate := range ChecksumAlgos {
+		if algo != "" && algo != candidate {
+			continue
+		}
+		for _, sibling := range []string{name + "." + candidate, name + "." + candidate + "sum"} {
+			if sum := readChecksum(fsys, sibling, path.Base(name)); sum != "" {
+				return sum, candidate, path.Base(sibling)
+			}
+		}
+	}
+	return "", algo, ""
+}
+
+// readChecksum reads the checksum for a file name from a checksum file, either as a bare checksum or in the format of sha256sum
+func readChecksum(fsys fs.FS, checksumFile, name string) string {
+	f, err := fsys.Open(checksumFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	first := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 || strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0]
+		}
+		if first == "" {
+			first = fields[0]
+		}
+	}
+	return first
+}
@@ -0,0 +1,49 @@
+package menuify
+
+import (
+	"testing"
+	"time"
+)
+
+// finishTask waits for the task pane on screen to finish and then leaves it
+func finishTask(t *testing.T, me *MenuEngine) {
+	t.Helper()
+	var op *OutputPane
+	me.Do(func() { op, _ = me.Menus[me.LoadedMenu].View.(*OutputPane) })
+	if op == nil {
+		t.Fatalf("no task pane on %q", me.LoadedMenu)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !op.Done(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("task didn't finish")
+		}
+	}
+	me.Action()
+}
+
+func TestChecksumAlgoFromVar(t *testing.T) {
+	me := newExplorerEngine()
+	me.SetVar("SUM", "0CC175B9C0F1B6A831C399E269772661") //md5 of "a"
+	me.Subscribe(EventVarChange, func(me *MenuEngine, ev *Event) {
+		me.Redraw() //used to deadlock, as the result was stored while rendering was locked
+	})
+	me.Do(func() { me.Checksum("mem:/a.txt", "", "SUM") })
+	finishTask(t, me)
+
+	if me.LoadedMenu != "INTERNAL_CHECKSUM" || me.Menus[me.LoadedMenu].Title != "PASS - checksum matches" {
+		t.Errorf("ended on %q titled %q", me.LoadedMenu, me.Menus[me.LoadedMenu].Title)
+	}
+	if algo, _ := me.GetVar("CHECKSUM_ALGO"); algo != "md5" {
+		t.Errorf("CHECKSUM_ALGO = %q", algo)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	me := newExplorerEngine()
+	me.SetVar("SUM", "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bc") //sha256 of "a"
+	me.Do(func() { me.Checksum("mem:/sub/b.txt", "", "SUM") })
+	finishTask(t, me)
+	if match, _ := me.GetVar("CHECKSUM_MATCH"); match != "false" || me.Menus[me.LoadedMenu].Title != "FAIL - checksum does not match" {
+		t.Errorf("CHECKSUM_MATCH = %q titled %q", match, me.Menus[me.LoadedMenu].Title)
+	}
+}
@@ -0,0 +1,228 @@
+package menuify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	DefaultVarTTL     = time.Second * 5  //how long a computed var's value is cached for if it doesn't set a TTL
+	DefaultVarTimeout = time.Second * 10 //how long a computed var's command can run for if its exec options don't set a timeout
+)
+
+// VarFunc computes the value of a computed var
+type VarFunc func(me *MenuEngine) (string, error)
+
+// ComputedVar is a var whose value comes from a command or a Go function, computed in the background and cached for its TTL
+// Until the first value is in it substitutes as empty, and once the TTL runs out it keeps using the cached value while a new one is computed
+type ComputedVar struct {
+	Exec     string       `json:"exec,omitempty"`     //a command whose output, without the trailing newline, is the value
+	ExecOpts *ExecOptions `json:"execOpts,omitempty"` //options for the command
+	Go       string       `json:"go,omitempty"`       //the name of a function registered with RegisterVarFunc
+	TTL      string       `json:"ttl,omitempty"`      //how long a value is cached for, i.e. 30s, DefaultVarTTL if unset
+	Func     VarFunc      `json:"-"`                  //computes the value directly, in place of Go and Exec
+
+	mu        sync.Mutex
+	value     string
+	err       error //why the last computation failed, if it did
+	expires   time.Time
+	computed  bool //a value has been computed at least once
+	computing bool
+}
+
+// ttl returns the parsed TTL, or DefaultVarTTL
+func (cv *ComputedVar) ttl() time.Duration {
+	if cv.TTL == "" {
+		return DefaultVarTTL
+	}
+	ttl, err := time.ParseDuration(cv.TTL)
+	if err != nil || ttl <= 0 {
+		return DefaultVarTTL
+	}
+	return ttl
+}
+
+// Err returns why the var's last computation failed, or nil if it succeeded
+func (cv *ComputedVar) Err() error {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return cv.err
+}
+
+// SetComputed adds a computed var, replacing any computed var with the same name
+// Computed vars are substituted by Vars, Expand and Eval, but aren't stored in Environment or exported to commands
+func (me *MenuEngine) SetComputed(name string, cv *ComputedVar) {
+	me.computedMu.Lock()
+	defer me.computedMu.Unlock()
+	if me.computed == nil {
+		me.computed = make(map[string]*ComputedVar)
+	}
+	me.computed[name] = cv
+}
+
+// UnsetComputed removes a computed var
+func (me *MenuEngine) UnsetComputed(name string) {
+	me.computedMu.Lock()
+	defer me.computedMu.Unlock()
+	delete(me.computed, name)
+}
+
+// RegisterVarFunc registers a named Go function for computed vars to use as their go source
+func (me *MenuEngine) RegisterVarFunc(name string, fn VarFunc) {
+	me.computedMu.Lock()
+	defer me.computedMu.Unlock()
+	if me.varFuncs == nil {
+		me.varFuncs = make(map[string]VarFunc)
+	}
+	me.varFuncs[name] = fn
+}
+
+func (me *MenuEngine) computedVar(name string) *ComputedVar {
+	me.computedMu.Lock()
+	defer me.computedMu.Unlock()
+	return me.computed[name]
+}
+
+// computedValue returns a computed var's value, computing it in the background when it's missing or expired
+// It's called while rendering, so it never waits on the computation and returns the last value, or empty the first time
+func (me *MenuEngine) computedValue(cv *ComputedVar) string {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	value := cv.value
+	if cv.computing || (cv.computed && time.Now().Before(cv.expires)) {
+		return value
+	}
+	cv.computing = true
+	go func() {
+		if me.recompute(cv) {
+			me.Do(me.Redraw)
+		}
+	}()
+	return value
+}
+
+// recompute computes a var's value, keeping the last value if it fails, and returns true if the value changed
+func (me *MenuEngine) recompute(cv *ComputedVar) bool {
+	value, err := me.compute(cv)
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	cv.computing = false
+	cv.computed = true
+	cv.expires = time.Now().Add(cv.ttl())
+	cv.err = err
+	if err != nil || value == cv.value {
+		return false
+	}
+	cv.value = value
+	return true
+}
+
+func (me *MenuEngine) compute(cv *ComputedVar) (string, error) {
+	switch {
+	case cv.Func != nil:
+		return cv.Func(me)
+	case cv.Go != "":
+		me.computedMu.Lock()
+		fn, ok := me.varFuncs[cv.Go]
+		me.computedMu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("unknown var function %q", cv.Go)
+		}
+		return fn(me)
+	case cv.Exec != "":
+		cmd, err := me.Command(cv.Exec, cv.ExecOpts)
+		if err != nil {
+			return "", err
+		}
+		if cmd.Timeout == 0 {
+			cmd.Timeout = DefaultVarTimeout
+		}
+		//Run directly rather than through runCommand, as exec events for every refresh would drown out the rest
+		res := cmd.Run()
+		if !res.Success() {
+			return "", fmt.Errorf("%s: %v", cv.Exec, res.Err)
+		}
+		return strings.TrimRight(string(res.Stdout), "\n"), nil
+	}
+	return "", fmt.Errorf("computed var has no exec, go or func")
+}
+
+// watchComputed redraws the loaded menu as often as the shortest TTL of the computed vars it references, until the menu changes
+func (me *MenuEngine) watchComputed() {
+	me.computedMu.Lock()
+	me.watchGen++
+	gen := me.watchGen
+	names := make([]string, 0, len(me.computed))
+	for name := range me.computed {
+		names = append(names, name)
+	}
+	me.computedMu.Unlock()
+
+	lm := me.Menus[me.LoadedMenu]
+	if lm == nil || len(names) == 0 {
+		return
+	}
+	//Conditions count too, as they can show, hide or disable items, including those of the menus that menu items lead to
+	texts := []string{lm.Title, lm.Subtitle}
+	for _, item := range lm.Items {
+		texts = append(texts, item.Text, item.Desc, item.VisibleIf, item.EnabledIf, item.DisabledReason)
+		if item.Type != "menu" {
+			continue
+		}
+		if target, ok := me.Menus[me.Vars(item.Action)]; ok && target != nil {
+			texts = append(texts, target.VisibleIf, target.EnabledIf, target.DisabledReason)
+		}
+	}
+	every := time.Duration(0)
+	for _, name := range names {
+		for _, text := range texts {
+			if referencesVar(text, name) {
+				if ttl := me.computedVar(name).ttl(); every == 0 || ttl < every {
+					every = ttl
+				}
+				break
+			}
+		}
+	}
+	if every == 0 {
+		return
+	}
+	if every < time.Second {
+		every = time.Second
+	}
+
+	menuID := me.LoadedMenu
+	go Interval(every, func() (err error) {
+		me.Do(func() {
+			me.computedMu.Lock()
+			current := me.watchGen == gen
+			me.computedMu.Unlock()
+			if !current || me.LoadedMenu != menuID {
+				err = fmt.Errorf("left menu")
+				return
+			}
+			me.Redraw()
+		})
+		return err
+	})
+}
+
+// referencesVar returns true if text refers to the var as $NAME or ${NAME...}
+func referencesVar(text, name string) bool {
+	for _, ref := range []string{"$" + name, "${" + name} {
+		for i := 0; ; {
+			j := strings.Index(text[i:], ref)
+			if j < 0 {
+				break
+			}
+			end := i + j + len(ref)
+			if end >= len(text) || !isVarChar(text[end]) {
+				return true
+			}
+			i = end
+		}
+	}
+	return false
+}
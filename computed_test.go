@@ -0,0 +1,74 @@
+package menuify
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComputedFirstUseDoesntWait(t *testing.T) {
+	release := make(chan struct{})
+	me := NewMenuEngine()
+	me.SetComputed("SLOW", &ComputedVar{TTL: "1h", Func: func(me *MenuEngine) (string, error) {
+		<-release
+		me.Redraw()
+		return "ready", nil
+	}})
+
+	var first string
+	me.Do(func() { first = me.Vars("[$SLOW]") })
+	if first != "[]" {
+		t.Errorf("first use gave %q, want it empty", first)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var value string
+		me.Do(func() { value = me.Vars("$SLOW") })
+		if value == "ready" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("computed %q", value)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestComputedInConditionsRefreshed(t *testing.T) {
+	me := NewMenuEngine()
+	calls := map[string]int{}
+	var mu sync.Mutex
+	counter := func(name string) *ComputedVar {
+		return &ComputedVar{TTL: "1s", Func: func(me *MenuEngine) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name]++
+			return "1", nil
+		}}
+	}
+	me.SetComputed("SHOWN", counter("SHOWN"))
+	me.SetComputed("READY", counter("READY"))
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{
+		{Text: "Shown", Type: "note", VisibleIf: "$SHOWN == 1"},
+		{Text: "Next", Type: "menu", Action: "next"},
+	}})
+	me.AddMenu("next", &MenuItemList{EnabledIf: "$READY == 1"})
+	me.SetScreen(&recordScreen{})
+	me.Do(func() { me.ChangeMenu("home") })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		shown, ready := calls["SHOWN"], calls["READY"]
+		mu.Unlock()
+		if shown > 1 && ready > 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("computed SHOWN %d times and READY %d times, want them kept up to date", shown, ready)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -1,8 +1,13 @@
 package menuify
 
 type MenuConfig struct {
-	Environment map[string]string        `json:"environment"`
-	Keybinds    []*MenuKeycodeBinding    `json:"keybinds"`
-	HomeMenu    string                   `json:"home"`
-	Menus       map[string]*MenuItemList `json:"menus"`
-}
\ No newline at end of file
+	Environment map[string]string                `json:"environment"`
+	EnvFallback bool                             `json:"envFallback,omitempty"` //look up vars missing from the environment in the OS environment
+	Keybinds    map[string][]*MenuKeycodeBinding `json:"keybinds,omitempty"`    //keyboard path -> bindings, as written by the calibrator
+	HomeMenu    string                           `json:"home"`
+	Menus       map[string]*MenuItemList         `json:"menus"`
+	Exec        *ExecOptions                     `json:"exec,omitempty"`     //limits applied to every exec action that doesn't set its own
+	Explorer    *ExplorerConfig                  `json:"explorer,omitempty"` //places listed on the explorer's root page
+	Events      map[string][]*EventExec          `json:"events,omitempty"`   //event name -> exec actions to run in the background when it's emitted
+	Computed    map[string]*ComputedVar          `json:"computed,omitempty"` //vars whose values come from a command or a registered Go function
+}
@@ -0,0 +1,97 @@
+package menuify
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JoshuaDoes/json"
+)
+
+var (
+	varName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+	listVar = regexp.MustCompile("^\\$@[A-Za-z_][A-Za-z0-9_]*$") //a list variable expanded into one word per line
+)
+
+// ParseValues parses values handed back by a command, either as env for KEY=VALUE lines or as json for an object
+func ParseValues(data []byte, format string) (map[string]string, error) {
+	values := make(map[string]string)
+	switch format {
+	case "env":
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			line = strings.TrimPrefix(line, "export ")
+			eq := strings.IndexByte(line, '=')
+			if eq < 0 {
+				return nil, fmt.Errorf("line %d: expected KEY=VALUE: %s", i+1, line)
+			}
+			key, value := line[:eq], line[eq+1:]
+			if !varName.MatchString(key) {
+				return nil, fmt.Errorf("line %d: invalid name: %s", i+1, key)
+			}
+			if value != "" && (value[0] == '"' || value[0] == '\'') {
+				words, err := SplitWords(value, nil)
+				if err != nil || len(words) != 1 {
+					return nil, fmt.Errorf("line %d: invalid quoted value: %s", i+1, value)
+				}
+				value = words[0]
+			}
+			values[key] = value
+		}
+	case "json":
+		object := make(map[string]interface{})
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, fmt.Errorf("expected a JSON object: %v", err)
+		}
+		for key, value := range object {
+			switch v := value.(type) {
+			case nil:
+				values[key] = ""
+			case string:
+				values[key] = v
+			case bool:
+				values[key] = strconv.FormatBool(v)
+			case float64:
+				values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				encoded, err := json.Marshal(v, false)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", key, err)
+				}
+				values[key] = string(encoded)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+	return values, nil
+}
+
+// ApplyResult stores a finished command's result in the environment, and parses any values it handed back according to the exec options
+func (me *MenuEngine) ApplyResult(res *Result, opts *ExecOptions) error {
+	me.SetResult(res)
+	if opts == nil || opts.Parse == "" {
+		return nil
+	}
+
+	data := res.Stdout
+	if opts.ParseFD {
+		data = res.Returned
+	}
+	if !res.Success() && len(strings.TrimSpace(string(data))) == 0 {
+		return nil //nothing was handed back
+	}
+
+	values, err := ParseValues(data, opts.Parse)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		me.SetVar(key, value)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package menuify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseValues(t *testing.T) {
+	for _, tt := range []struct {
+		data, format string
+		want         map[string]string
+	}{
+		{"A=1\nB=two words\n", "env", map[string]string{"A": "1", "B": "two words"}},
+		{"# comment\n\n  export A=1  \nEMPTY=\n", "env", map[string]string{"A": "1", "EMPTY": ""}},
+		{`A="quoted \"value\""` + "\nB='single $quoted'", "env", map[string]string{"A": `quoted "value"`, "B": "single $quoted"}},
+		{"URL=http://x/?a=b", "env", map[string]string{"URL": "http://x/?a=b"}},
+		{`{"s": "text", "n": 1.5, "i": 3, "b": true, "z": null}`, "json", map[string]string{"s": "text", "n": "1.5", "i": "3", "b": "true", "z": ""}},
+		{`{"list": [1, "a"]}`, "json", map[string]string{"list": `[1,"a"]`}},
+		{"", "env", map[string]string{}},
+	} {
+		got, err := ParseValues([]byte(tt.data), tt.format)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseValues(%q, %s) = %q, %v, want %q", tt.data, tt.format, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ data, format string }{
+		{"no equals sign", "env"},
+		{"1BAD=name", "env"},
+		{"A-B=name", "env"},
+		{`A="unterminated`, "env"},
+		{`A="two" "words"`, "env"},
+		{`["not", "an object"]`, "json"},
+		{`{"broken": `, "json"},
+		{"A=1", "yaml"},
+	} {
+		if _, err := ParseValues([]byte(tt.data), tt.format); err == nil {
+			t.Errorf("ParseValues(%q, %s) didn't fail", tt.data, tt.format)
+		}
+	}
+}
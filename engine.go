@@ -1,30 +1,55 @@
 package menuify
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // MenuItem holds an item for a menu, such as a button, a checkbox, or an input box
 type MenuItem struct {
-	Text   string `json:"text"`
-	Desc   string `json:"desc"`
-	Type   string `json:"type"`   //menu, exec, explorer[:pwd], note, var name
-	Action string `json:"action"` //var: string[:limit]|number[:min[:max]]|file[:extension1[,extension2,...]]|bool|opts:opt1,opt2,[opt3,...]
+	Text     string       `json:"text"`
+	Desc     string       `json:"desc"`
+	Type     string       `json:"type"`               //menu, exec, explorer[:pwd], view[ follow], checksum[ algo[ expectedVar]], go, note, refresh, var name, or a registered item type
+	Action   string       `json:"action"`             //var: string[:limit]|number[:min[:max]]|file[:extension1[,extension2,...]]|bool|opts:opt1,opt2,[opt3,...]
+	ExecOpts *ExecOptions `json:"execOpts,omitempty"` //options for exec actions
+	Key      string       `json:"key,omitempty"`      //identifies a generated item across refreshes, defaults to its type, action and text
+
+	ExplorerOpts *ExplorerOptions `json:"explorerOpts,omitempty"` //options for explorer actions
+
+	VisibleIf      string `json:"visibleIf,omitempty"`      //an expression that hides the item when false, see Eval
+	EnabledIf      string `json:"enabledIf,omitempty"`      //an expression that disables the item when false
+	DisabledReason string `json:"disabledReason,omitempty"` //shown next to the item while it's disabled
 }
 
 // MenuItemList holds a list of items to interact with
 type MenuItemList struct {
-	Title      string      `json:"title"`
-	Subtitle   string      `json:"subtitle"`
-	Items      []*MenuItem `json:"items"`      //items to display on the page
-	NoGoBack   bool        `json:"noGoBack"`   //hides the go back button
-	NoSelector bool        `json:"noSelector"` //hides the item cursor
-	DefaultCur int         `json:"defaultCur"` //the cursor to set by default
-	Exec       string      `json:"exec"`       //a line interpreted as an exec action
+	Title      string         `json:"title"`
+	Subtitle   string         `json:"subtitle"`
+	Items      []*MenuItem    `json:"items"`               //items to display on the page
+	NoGoBack   bool           `json:"noGoBack"`            //hides the go back button
+	NoSelector bool           `json:"noSelector"`          //hides the item cursor
+	DefaultCur int            `json:"defaultCur"`          //the cursor to set by default
+	Exec       string         `json:"exec"`                //a line interpreted as an exec action
+	ExecOpts   *ExecOptions   `json:"execOpts,omitempty"`  //options for the exec action
+	ExecMode   string         `json:"execMode,omitempty"`  //append (default) adds the output after the items each time, replace swaps out the output of the last run
+	Generator  *MenuGenerator `json:"generator,omitempty"` //generates items after the configured ones from a command's output
+	View       MenuView       `json:"-"`                   //takes over rendering and input in place of the items
+
+	VisibleIf      string `json:"visibleIf,omitempty"`      //hides menu items leading to this menu when false
+	EnabledIf      string `json:"enabledIf,omitempty"`      //disables menu items leading to this menu when false
+	DisabledReason string `json:"disabledReason,omitempty"` //shown next to those items while they're disabled
+
+	loading       *menuLoad      //set while the exec action or generator runs in the background
+	execCancelled bool           //the exec action was cancelled before it finished, so it runs again when the menu is returned to
+	configured    []*MenuItem    //the items from before any exec output or generated items were added
+	watching      bool           //the generator is refreshing on a timer
+	explorer      *explorerState //set on menus listed by an explorer
 }
 
 func (m *MenuItemList) AddItem(name, desc, itemType, action string) {
@@ -40,14 +65,52 @@ type MenuEngine struct {
 	MenuHistory []string
 	ItemHistory []int
 	Environment map[string]string //global variables set by menus
+	EnvFallback bool              //look up vars missing from Environment in the OS environment
 	ItemCursor  int
 	Locked      bool
-	Return      string                          //return value set by some menu types
-	Hooks       map[string]func(me *MenuEngine) //run a hook after changing to a menu
+	stateMu     sync.Mutex                      //held while handling input and by Do, so background goroutines don't race it
+	Hooks       map[string]func(me *MenuEngine) //run a hook after changing to a menu, see Subscribe for more events
+	events      eventBus
+	itemTypes   map[string]*ItemType //custom item types, by name
+	actions     map[string]GoAction  //named Go actions for items with type "go"
+	flows       []*Flow              //modal sub-flows in progress, innermost last
+	envMu       sync.RWMutex
+	computed    map[string]*ComputedVar //vars computed by commands or Go functions, by name
+	varFuncs    map[string]VarFunc      //named Go functions for computed vars
+	watchGen    int                     //bumped on each menu change to stop the last menu's computed var refreshes
+	computedMu  sync.Mutex
+
+	//Exec control
+	ExecDefaults *ExecOptions //limits applied to every exec action that doesn't set its own
+
+	//Explorer control
+	Filesystems   map[string]fs.FS //roots explorers can browse as name:/path, the root named "" replaces the OS filesystem
+	Places        *ExplorerConfig  //bookmarks, recent directories and mount points for the explorer's root page
+	archives      map[string]fs.FS //archives opened by explorers, by location
+	archivesMu    sync.Mutex
+	fileOp        *fileOp         //the file action in progress, if any
+	recent        []string        //recently visited directories, loaded from Places.RecentFile when first needed
+	recentSaved   string          //the recent directories as last read from or written to Places.RecentFile
+	recentPending bool            //a save of the recent directories is waiting on RecentSaveDelay
+	spacePending  map[string]bool //mount points with a free space lookup still running
+
+	//Background jobs
+	Jobs      []*Job
+	OnJobDone func(me *MenuEngine, job *Job) //called after a job finishes, in addition to the notice
+	jobsMu    sync.Mutex
+	nextJob   int
+	jobsWatch int    //bumped each time the jobs menu is entered, to stop the last refresh ticker
+	notice    string //shown in the footer until the next input
+
+	//Input control
+	Keybinds  map[string][]*MenuKeycodeBinding //keyboard path -> bindings, from the config or the calibrator
+	keysrv    []*KeycodeListener
+	suspended bool //another program has the terminal, so don't render
 
 	//Rendering control
-	Screen MenuScreen
+	Screen         MenuScreen
 	LinesV, LinesH int
+	renderMu       sync.Mutex
 }
 
 // NewMenuEngine returns a menu engine ready to be used
@@ -62,6 +125,7 @@ func NewMenuEngine() *MenuEngine {
 		ItemHistory: make([]int, 0),
 		Environment: env,
 		Hooks:       make(map[string]func(me *MenuEngine)),
+		Keybinds:    make(map[string][]*MenuKeycodeBinding),
 
 		//Default to 80x40
 		LinesH: 80,
@@ -89,6 +153,38 @@ func (me *MenuEngine) Unlock() {
 	me.Locked = false
 }
 
+// Do runs fn with the engine locked against input and other background work
+// Input, hooks, event handlers and item actions already run locked, so only goroutines of your own need Do to use the engine
+func (me *MenuEngine) Do(fn func()) {
+	me.stateMu.Lock()
+	defer me.stateMu.Unlock()
+	fn()
+}
+
+// SetVar sets a variable in the environment, emitting varChange if it changed
+// Like other engine methods it needs the engine locked, see Do, though GetVar is safe from anywhere
+func (me *MenuEngine) SetVar(name, value string) {
+	me.envMu.Lock()
+	if me.Environment == nil {
+		me.Environment = make(map[string]string)
+	}
+	previous, existed := me.Environment[name]
+	me.Environment[name] = value
+	me.envMu.Unlock()
+
+	if !existed || previous != value {
+		me.Emit(&Event{Name: EventVarChange, Data: map[string]string{"name": name, "value": value, "previous": previous}})
+	}
+}
+
+// GetVar returns a variable from the environment, and is safe to call from background jobs
+func (me *MenuEngine) GetVar(name string) (string, bool) {
+	me.envMu.RLock()
+	defer me.envMu.RUnlock()
+	value, ok := me.Environment[name]
+	return value, ok
+}
+
 func (me *MenuEngine) init() {
 	if me.Menus == nil {
 		me.Menus = make(map[string]*MenuItemList)
@@ -105,6 +201,9 @@ func (me *MenuEngine) init() {
 	if me.Hooks == nil {
 		me.Hooks = make(map[string]func(me *MenuEngine))
 	}
+	if me.Keybinds == nil {
+		me.Keybinds = make(map[string][]*MenuKeycodeBinding)
+	}
 }
 
 func (me *MenuEngine) isBackVisible() bool {
@@ -116,54 +215,87 @@ func (me *MenuEngine) isBackVisible() bool {
 
 // PrevItem navigates to the previous menu item, or to the last if none previous
 func (me *MenuEngine) PrevItem() {
+	me.stateMu.Lock()
+	defer me.stateMu.Unlock()
 	if me.Locked {
 		return
 	}
 	me.init()
+	me.notice = ""
 	defer me.render()
 
-	if me.isBackVisible() && me.ItemCursor == -1 {
-		me.ItemCursor = len(me.Menus[me.LoadedMenu].Items) - 1
-	} else if !me.isBackVisible() && me.ItemCursor == 0 {
-		me.ItemCursor = len(me.Menus[me.LoadedMenu].Items) - 1
-	} else {
-		me.ItemCursor--
+	if view := me.Menus[me.LoadedMenu].View; view != nil {
+		view.PrevItem(me)
+		return
 	}
 
-	if me.ItemCursor >= 0 && me.Menus[me.LoadedMenu].Items[me.ItemCursor].Type == "divider" {
-		me.PrevItem()
+	//Skip dividers, hidden and disabled items, giving up after one lap
+	items := me.Menus[me.LoadedMenu].Items
+	for lap := 0; lap <= len(items); lap++ {
+		if me.isBackVisible() && me.ItemCursor == -1 {
+			me.ItemCursor = len(items) - 1
+		} else if !me.isBackVisible() && me.ItemCursor == 0 {
+			me.ItemCursor = len(items) - 1
+		} else {
+			me.ItemCursor--
+		}
+		if me.ItemCursor < 0 || me.selectable(items[me.ItemCursor]) {
+			break
+		}
 	}
+	me.Emit(&Event{Name: EventCursorMove, Item: me.cursorItem()})
 }
 
 // NextItem navigates to the next menu item, or to the first if none next
 func (me *MenuEngine) NextItem() {
+	me.stateMu.Lock()
+	defer me.stateMu.Unlock()
 	if me.Locked {
 		return
 	}
 	me.init()
+	me.notice = ""
 	defer me.render()
 
-	if (me.ItemCursor + 1) >= len(me.Menus[me.LoadedMenu].Items) {
-		if me.isBackVisible() {
-			me.ItemCursor = -1
-		} else {
-			me.ItemCursor = 0
-		}
-	} else {
-		me.ItemCursor++
+	if view := me.Menus[me.LoadedMenu].View; view != nil {
+		view.NextItem(me)
+		return
 	}
 
-	if me.ItemCursor >= 0 && me.Menus[me.LoadedMenu].Items[me.ItemCursor].Type == "divider" {
-		me.NextItem()
+	//Skip dividers, hidden and disabled items, giving up after one lap
+	items := me.Menus[me.LoadedMenu].Items
+	for lap := 0; lap <= len(items); lap++ {
+		if (me.ItemCursor + 1) >= len(items) {
+			if me.isBackVisible() {
+				me.ItemCursor = -1
+			} else {
+				me.ItemCursor = 0
+			}
+		} else {
+			me.ItemCursor++
+		}
+		if me.ItemCursor < 0 || len(items) == 0 || me.selectable(items[me.ItemCursor]) {
+			break
+		}
 	}
+	me.Emit(&Event{Name: EventCursorMove, Item: me.cursorItem()})
 }
 
 // Action activates the selected item's action, such as navigating to a menu or executing a program
 func (me *MenuEngine) Action() {
+	me.stateMu.Lock()
+	defer me.stateMu.Unlock()
 	if me.Locked {
 		return
 	}
 	me.init()
+	me.notice = ""
+
+	if view := me.Menus[me.LoadedMenu].View; view != nil {
+		view.Action(me)
+		me.Redraw()
+		return
+	}
 
 	if me.ItemCursor == -1 {
 		me.PrevMenu()
@@ -175,7 +307,16 @@ func (me *MenuEngine) Action() {
 	}
 
 	selectedItem := me.Menus[me.LoadedMenu].Items[me.ItemCursor]
-	selectedAction := me.Vars(selectedItem.Action)
+	if visible, enabled, reason := me.itemState(selectedItem); !visible || !enabled {
+		me.Notify(reason)
+		return
+	}
+	me.Emit(&Event{Name: EventItemActivate, Item: selectedItem})
+	selectedAction, err := me.Expand(selectedItem.Action)
+	if err != nil && selectedItem.Type != "exec" { //exec actions expand their own words, and report the same error
+		me.ErrorText("Failed to expand vars", err.Error())
+		return
+	}
 	itemArgs := strings.Split(me.Vars(selectedItem.Type), " ")
 	actionArgs := strings.Split(selectedAction, " ")
 	switch itemArgs[0] {
@@ -185,136 +326,383 @@ func (me *MenuEngine) Action() {
 			if len(actionArgs) > 1 {
 				me.ChangeMenu(actionArgs[1])
 			}
+			me.SaveRecent() //a visit might still be waiting to be saved
 			os.Exit(1)
 		case "exit":
 			if len(actionArgs) > 1 {
 				me.ChangeMenu(actionArgs[1])
 			}
+			me.SaveRecent()
 			os.Exit(0)
+		case "jobs":
+			me.JobsMenu()
+		case "explorer":
+			if len(actionArgs) < 2 {
+				me.ErrorText("Missing explorer action", selectedAction)
+				return
+			}
+			me.ExplorerAction(strings.Join(actionArgs[1:], " "))
+		case "file":
+			switch {
+			case len(actionArgs) < 2:
+				me.ErrorText("Missing file action", selectedAction)
+			case actionArgs[1] == "menu":
+				me.FileMenu(strings.Join(actionArgs[2:], " "))
+			default:
+				me.FileAction(actionArgs[1])
+			}
+		case "job":
+			if len(actionArgs) < 3 {
+				me.ErrorText("Missing job ID or action", selectedAction)
+				return
+			}
+			me.JobAction(actionArgs[1], actionArgs[2])
 		default:
 			me.ErrorText("Unknown internal action", selectedAction)
 		}
 	case "menu":
 		me.ChangeMenu(actionArgs[0])
 	case "exec":
-		me.RunRealtime(selectedAction)
+		me.runExec(selectedItem.Action, selectedItem.ExecOpts)
 	case "explorer":
-		workingDir := "/"
+		workingDir := "" //the root page
 		if len(itemArgs) > 1 {
 			workingDir = strings.Join(itemArgs[1:], " ")
 		}
-		me.Explorer(workingDir, selectedAction)
-	case "return":
-		if me.Return != "" {
-			me.Environment[me.Return] = selectedAction
-			me.Return = ""
-		}
-		me.PrevMenu()
-
-		//Back all the way out of an explorer context
-		for {
-			if string(me.Menus[me.LoadedMenu].Title[:8]) == "Explorer" {
-				me.PrevMenu()
-				continue
+		opts := selectedItem.ExplorerOpts
+		if selectedItem.ExecOpts != nil {
+			//The bin runs with the item's exec options, wherever in the explorer it's run from
+			withExec := ExplorerOptions{}
+			if opts != nil {
+				withExec = *opts
 			}
-			break
+			withExec.exec = selectedItem.ExecOpts
+			opts = &withExec
 		}
+		me.ExplorerWith(workingDir, selectedItem.Action, opts) //the bin is expanded word by word when it runs
+	case "view":
+		me.ViewFile(selectedAction, len(itemArgs) > 1 && itemArgs[1] == "follow")
+	case "checksum":
+		algo, expectedVar := "", ""
+		if len(itemArgs) > 1 && itemArgs[1] != "auto" {
+			algo = itemArgs[1]
+		}
+		if len(itemArgs) > 2 {
+			expectedVar = itemArgs[2]
+		}
+		me.Checksum(selectedAction, algo, expectedVar)
+	case "return":
+		me.ReturnFlow(selectedAction)
+	case "cancel":
+		me.CancelFlow()
 	case "setvar":
-		me.Return = itemArgs[1] //set var for what to return to
+		if len(itemArgs) < 2 {
+			me.ErrorText("Missing var name", selectedItem.Type)
+			return
+		}
+		varName := itemArgs[1] //set var for what to return to
 		if len(itemArgs) > 2 {
-			me.Environment[itemArgs[1]] = itemArgs[2] //The value was supplied by the menu
+			me.SetVar(itemArgs[1], itemArgs[2]) //The value was supplied by the menu
 		}
 		for i := 3; i < len(itemArgs); i++ {
 			if i+1 < len(itemArgs) {
-				me.Environment[itemArgs[i]] = itemArgs[i+1]
+				me.SetVar(itemArgs[i], itemArgs[i+1])
 			}
 			i++
 		}
 
+		opts := selectedItem.ExplorerOpts
+		if actionArgs[0] == "file" || strings.HasPrefix(actionArgs[0], "file:") {
+			opts = FileOptions(actionArgs[0], opts) //file[:extension1[,extension2,...]] picks a file with the explorer
+			actionArgs[0] = "explorer"
+		}
+
 		switch actionArgs[0] {
 		case "explorer":
-			workingDir := "/"
+			workingDir := "" //the root page
 			if len(actionArgs) > 1 {
 				workingDir = strings.Join(actionArgs[1:], " ")
 			}
-			me.Explorer(workingDir, "")
+			me.StartFlow(varName, nil)
+			me.ExplorerWith(workingDir, "", opts)
 		case "menu":
+			me.StartFlow(varName, nil)
 			me.ChangeMenu(actionArgs[1])
+		case "input":
+			value, _ := me.GetVar(varName)
+			me.Input(selectedItem.Text, strings.Join(actionArgs[1:], " "), value, func(me *MenuEngine, value string) {
+				me.SetVar(varName, value)
+			})
 		default:
-			me.ErrorText("Unknown action for var " + me.Return, selectedAction)
+			me.ErrorText("Unknown action for var "+varName, selectedAction)
 		}
+	case "refresh":
+		me.Refresh()
 	case "note":
 		if selectedAction != "" {
 			me.DisplayText(selectedAction)
 		} else {
 			me.Redraw() //hide the newline
 		}
+	case "go":
+		//Split the action as written, so a var's value stays in one argument however many words it has
+		args, err := SplitWords(selectedItem.Action, me.Vars)
+		if err != nil || len(args) == 0 {
+			me.ErrorText("Invalid Go action", selectedItem.Action)
+			return
+		}
+		me.GoAction(args[0], args[1:])
 	default:
+		if itemType, args := me.itemType(selectedItem); itemType != nil && itemType.Activate != nil {
+			itemType.Activate(me, selectedItem, args, selectedAction)
+			return
+		}
 		me.ErrorText("Unknown action: " + selectedItem.Type, selectedAction)
 	}
 }
 
-// Explorer abuses the powers of AddMenu, ChangeMenu, and PrevMenu to create a file browser with support for passing a selected file to an executable
-func (me *MenuEngine) Explorer(workingDir, bin string) {
-	if workingDir[len(workingDir)-1] != '/' {
-		workingDir += "/"
-	}
-
-	displayBin := workingDir
-	if bin != "" {
-		displayBin = strings.Replace(bin, "$?", workingDir, -1)
+// Command parses a command line from a menu into a Command, substituting vars into single arguments and exporting the environment to it
+// Limits come from the exec options, falling back to ExecDefaults
+func (me *MenuEngine) Command(line string, opts *ExecOptions) (*Command, error) {
+	opts = opts.withDefaults(me.ExecDefaults)
+	if opts.Shell && len(opts.files) > 0 {
+		quoted := make([]string, len(opts.files))
+		for i, file := range opts.files {
+			quoted[i] = ShellQuote(file)
+		}
+		line = strings.Replace(line, "$?", strings.Join(quoted, " "), -1)
 	}
-	explorer := &MenuItemList{
-		Title: "Explorer - " + displayBin,
-		Items: make([]*MenuItem, 0),
+	var expandErr error
+	cmd, err := NewCommand(line, opts.Shell, func(in string) string {
+		if len(opts.files) > 0 {
+			in = strings.Replace(in, "$?", fileMarker, -1)
+		}
+		out, err := me.Expand(in)
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+		return out
+	})
+	if err == nil {
+		err = expandErr
 	}
-
-	files, err := ioutil.ReadDir(workingDir)
 	if err != nil {
-		explorer.AddItem("Failed to list the files in "+workingDir, fmt.Sprintf("%v", err), "note", "")
-	} else {
-		for _, file := range files {
-			if file.IsDir() {
-				explorer.AddItem(file.Name()+"/", workingDir+file.Name()+"/", "explorer "+workingDir+file.Name(), bin)
-			} else {
-				if bin != "" {
-					explorer.AddItem(file.Name(), "", "exec", strings.Replace(bin, "$?", fmt.Sprintf("%s%s", workingDir, file.Name()), -1))
-				} else {
-					explorer.AddItem(file.Name(), "", "return", workingDir+file.Name())
-				}
-			}
+		return nil, err
+	}
+	if len(opts.files) > 0 && !opts.Shell {
+		cmd.Args = substituteFiles(cmd.Args, opts.files)
+	}
+	cmd.Env = me.Environ()
+	if cmd.Dir, err = me.Expand(opts.Dir); err != nil {
+		return nil, err
+	}
+	cmd.Grace = opts.grace()
+	cmd.Timeout = opts.timeout()
+	cmd.MaxOutput = opts.MaxOutput
+	cmd.KillGroup = opts.KillGroup
+	cmd.ResultFD = opts.Parse != "" && opts.ParseFD
+	if progress := opts.progress(); progress != "" {
+		cmd.Progress = &Progress{}
+		cmd.ProgressStdout = progress == "stdout"
+	}
+	return cmd, nil
+}
+
+// Environ returns the environment as KEY=VALUE pairs for a child process, skipping any names a process can't hold
+func (me *MenuEngine) Environ() []string {
+	me.envMu.RLock()
+	defer me.envMu.RUnlock()
+	names := make([]string, 0, len(me.Environment))
+	for name := range me.Environment {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			continue
 		}
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	me.AddMenu(workingDir, explorer)
-	me.ChangeMenu(workingDir)
+	env := make([]string, len(names))
+	for i := 0; i < len(names); i++ {
+		env[i] = names[i] + "=" + me.Environment[names[i]]
+	}
+	return env
 }
 
 // RunRealtime runs the given command, but doesn't halt the menu engine
 func (me *MenuEngine) RunRealtime(command string) {
-	me.Lock()
-	defer me.Unlock()
-	err := RunRealtime(me.Vars(command))
-	if err != nil {
-		me.ErrorText(err.Error(), "")
+	me.RunRealtimeWith(command, nil)
+}
+
+// RunRealtimeWith runs the given command with exec options as a job, streaming its output into a pane that takes over the screen
+// Once the command finishes, selecting the pane leaves it and follows the options' routing
+// Interactive commands are handed the terminal instead, and PTY commands run in a terminal pane, so no output pane is returned
+func (me *MenuEngine) RunRealtimeWith(command string, opts *ExecOptions) *OutputPane {
+	if opts != nil && opts.Interactive {
+		me.RunInteractive(command, opts)
+		return nil
+	}
+	if opts != nil && opts.PTY {
+		me.RunTerminal(command, opts)
+		return nil
+	}
+
+	job := me.StartJob(command, opts)
+	if job == nil {
+		return nil
+	}
+	me.ShowView("OUTPUT", command, job.Pane)
+	return job.Pane
+}
+
+// runExec runs an exec action as its options ask, starting a background job or taking over the screen
+func (me *MenuEngine) runExec(command string, opts *ExecOptions) {
+	if opts != nil && opts.Background {
+		if job := me.StartJob(command, opts); job != nil {
+			me.Notify(fmt.Sprintf("Started job #%d", job.ID))
+		}
 		return
 	}
+	me.RunRealtimeWith(command, opts)
+}
+
+// RunInteractive suspends the screen and input, hands the terminal to the given command until it exits, and then redraws
+func (me *MenuEngine) RunInteractive(command string, opts *ExecOptions) *Result {
+	cmd, err := me.Command(command, opts)
+	if err != nil {
+		me.ErrorText(err.Error(), command)
+		return nil
+	}
+	cmd.Terminal = true
+
+	me.Suspend()
+	res := me.runCommand(context.Background(), cmd, false)
+	me.Resume()
+
+	if err := me.ApplyResult(res, opts); err != nil {
+		me.ErrorText("Failed to parse output", err.Error())
+		return res
+	}
+	if me.route(res, opts) {
+		return res
+	}
+	if res.TimedOut {
+		me.ErrorText("Timed out after "+cmd.Timeout.String(), command)
+	} else if res.Err != nil {
+		me.ErrorText(res.Err.Error(), command)
+	}
+	return res
+}
+
+// Suspend locks the engine, pauses the keycode listeners and suspends the screen if it supports it, so another program can use the terminal
+func (me *MenuEngine) Suspend() {
+	me.Lock()
+	for _, kl := range me.keysrv {
+		kl.Pause()
+	}
+	me.renderMu.Lock()
+	me.suspended = true
+	if suspender, ok := me.Screen.(MenuSuspender); ok {
+		suspender.Suspend()
+	}
+	me.renderMu.Unlock()
+}
+
+// Resume undoes Suspend and redraws the menu
+func (me *MenuEngine) Resume() {
+	me.renderMu.Lock()
+	if suspender, ok := me.Screen.(MenuSuspender); ok {
+		suspender.Resume()
+	}
+	me.suspended = false
+	me.renderMu.Unlock()
+	for _, kl := range me.keysrv {
+		kl.Resume()
+	}
+	me.Unlock()
+	me.Redraw()
 }
 
 // Run runs the given command, but halts the menu engine until completion
 func (me *MenuEngine) Run(command string) {
+	me.RunWith(command, nil)
+}
+
+// RunWith runs the given command with exec options, but halts the menu engine until completion
+// Unless the options route elsewhere, the output is added to the loaded menu as a note
+func (me *MenuEngine) RunWith(command string, opts *ExecOptions) *Result {
 	me.Lock()
-	defer me.Unlock()
-	out, err := Run(me.Vars(command))
-	outString := string(out)
+	cmd, err := me.Command(command, opts)
 	if err != nil {
-		me.ErrorText(err.Error(), outString)
+		me.Unlock()
+		me.ErrorText(err.Error(), command)
+		return nil
+	}
+	res := me.runCommand(context.Background(), cmd, false)
+	me.Unlock()
+
+	me.addResult(me.Menus[me.LoadedMenu], cmd, res, opts)
+	return res
+}
+
+// addResult follows the exec options' routing for a result, or reports a failure to run, or adds the output to a menu as a note
+func (me *MenuEngine) addResult(lm *MenuItemList, cmd *Command, res *Result, opts *ExecOptions) {
+	if err := me.ApplyResult(res, opts); err != nil {
+		me.ErrorText("Failed to parse output", err.Error())
+		return
+	}
+	if me.route(res, opts) {
+		return
+	}
+	if res.TimedOut {
+		me.ErrorText("Timed out after "+cmd.Timeout.String(), tailLines(string(res.Output), 10))
 		return
 	}
-	me.Menus[me.LoadedMenu].AddItem(outString, "Task complete", "note", "")
+	if !res.Started() {
+		me.ErrorText(res.Err.Error(), string(res.Output))
+		return
+	}
+	status := "Task complete"
+	if !res.Success() {
+		status = fmt.Sprintf("Task failed (exit status %d)", res.ExitCode)
+	}
+
+	me.renderMu.Lock()
+	if lm.ExecMode == "replace" {
+		if lm.configured == nil {
+			lm.configured = lm.Items
+		}
+		lm.Items = append(lm.configured[:len(lm.configured):len(lm.configured)], &MenuItem{Text: string(res.Output), Desc: status, Type: "note"})
+	} else {
+		lm.AddItem(string(res.Output), status, "note", "")
+	}
+	me.renderMu.Unlock()
 	me.render()
 }
 
+// SetResult stores a finished command's exit code and output in the environment as EXITCODE, STDOUT and STDERR
+// $? is left alone, as explorers use it as the placeholder for the selected file
+func (me *MenuEngine) SetResult(res *Result) {
+	me.SetVar("EXITCODE", strconv.Itoa(res.ExitCode))
+	me.SetVar("STDOUT", strings.TrimRight(string(res.Stdout), "\n"))
+	me.SetVar("STDERR", strings.TrimRight(string(res.Stderr), "\n"))
+}
+
+// route changes to the menu the exec options pick for a result, returning false if they don't pick one
+func (me *MenuEngine) route(res *Result, opts *ExecOptions) bool {
+	if opts == nil {
+		return false
+	}
+	menuID := opts.OnFailure
+	if res.Success() {
+		menuID = opts.OnSuccess
+	}
+	if menuID == "" {
+		return false
+	}
+	me.ChangeMenu(menuID)
+	return true
+}
+
 // AddMenu adds a menu to the menu list
 func (me *MenuEngine) AddMenu(menuID string, menu *MenuItemList) {
 	me.init()
@@ -341,17 +729,29 @@ func (me *MenuEngine) ChangeMenu(menuID string) {
 		me.ErrorText("Unknown menu", menuID)
 		return
 	}
+	me.cancelLoad()
 
 	if me.LoadedMenu != "" { //&& me.LoadedMenu != "INTERNAL_ERROR_TEXT" {
+		me.Emit(&Event{Name: EventMenuLeave})
 		me.MenuHistory = append(me.MenuHistory, me.LoadedMenu)
 		me.ItemHistory = append(me.ItemHistory, me.ItemCursor)
 	}
 
 	me.LoadedMenu = menuID
 	me.ItemCursor = lm.DefaultCur
+	me.fixCursor()
 
 	if lm.Exec != "" {
-		me.Run(lm.Exec)
+		me.loadMenu(menuID, lm)
+		if me.LoadedMenu != menuID {
+			return //the exec action couldn't start
+		}
+	}
+	if lm.Generator != nil {
+		me.enterGenerator(menuID, lm, false)
+		if me.LoadedMenu != menuID {
+			return //the generator couldn't start
+		}
 	}
 
 	me.render()
@@ -360,6 +760,8 @@ func (me *MenuEngine) ChangeMenu(menuID string) {
 	if ok {
 		me.Hooks[menuID](me)
 	}
+	me.watchComputed()
+	me.Emit(&Event{Name: EventMenuEnter})
 }
 
 // Home returns to the home menu
@@ -371,6 +773,7 @@ func (me *MenuEngine) Home() {
 func (me *MenuEngine) PrevMenu() {
 	me.init()
 	defer me.render()
+	me.cancelLoad()
 
 	if len(me.MenuHistory) == 0 {
 		return //We can't go back to nothing, or can we?
@@ -380,6 +783,8 @@ func (me *MenuEngine) PrevMenu() {
 	me.MenuHistory = me.MenuHistory[:len(me.MenuHistory)-1] //Remove this menu from history regardless of it being valid
 	itemCursor := me.ItemHistory[len(me.ItemHistory)-1]     //Get the previous item cursor
 	me.ItemHistory = me.ItemHistory[:len(me.ItemHistory)-1] //Remove this item cursor from history regardless of it being valid
+	me.dropFlows()
+	me.Emit(&Event{Name: EventMenuLeave})
 
 	_, ok := me.Menus[menuID]
 	if !ok {
@@ -398,16 +803,31 @@ func (me *MenuEngine) PrevMenu() {
 
 	me.LoadedMenu = menuID
 	me.ItemCursor = itemCursor
+	me.fixCursor()
+	me.dropArchives()
+
+	if lm := me.Menus[menuID]; lm.Exec != "" && lm.execCancelled {
+		me.loadMenu(menuID, lm)
+		if me.LoadedMenu != menuID {
+			return //the exec action couldn't start
+		}
+	}
+	if lm := me.Menus[menuID]; lm.Generator != nil {
+		me.enterGenerator(menuID, lm, true)
+	}
 
 	_, ok = me.Hooks[menuID]
 	if ok {
 		me.Hooks[menuID](me)
 	}
+	me.watchComputed()
+	me.Emit(&Event{Name: EventMenuEnter})
 }
 
 // ErrorText generates an error message menu with menuID "INTERNAL_ERROR_TEXT" and navigates to it
 // It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
 func (me *MenuEngine) ErrorText(err, extra string) {
+	me.Emit(&Event{Name: EventError, Data: map[string]string{"error": err, "detail": extra}})
 	menuError := &MenuItemList{
 		NoGoBack: true,
 		Title:    err,
@@ -441,11 +861,13 @@ func (me *MenuEngine) ResetHistory() {
 	me.ItemCursor = 0
 	me.ItemHistory = make([]int, 0)
 	me.MenuHistory = make([]string, 0)
+	me.flows = nil
 }
 
 type MenuFrame struct {
 	Header, Menu, Footer string
 }
+
 func (mf *MenuFrame) Empty() bool {
 	return mf.Header == "" && mf.Menu == "" && mf.Footer == ""
 }
@@ -471,6 +893,14 @@ func (me *MenuEngine) GetRender() *MenuFrame {
 		menu.Header += lm.Subtitle
 	}
 
+	if lm.View != nil {
+		//Views render raw text, so only the header gets vars
+		menu.Header = me.Vars(menu.Header)
+		lm.View.Render(me, menu)
+		me.renderNotice(menu)
+		return menu
+	}
+
 	if len(lm.Items) > 0 {
 		for i := 0; i < len(lm.Items); i++ {
 			switch lm.Items[i].Type {
@@ -483,19 +913,26 @@ func (me *MenuEngine) GetRender() *MenuFrame {
 					menu.Menu += "\n"
 				}
 			default:
+				visible, enabled, reason := me.itemState(lm.Items[i])
+				if !visible {
+					continue
+				}
 				if !lm.NoSelector && me.ItemCursor == i {
 					menu.Menu += "-> "
 				} else {
 					menu.Menu += "  "
 				}
-				menu.Menu += lm.Items[i].Text
-				if lm.Items[i].Type == "menu" {
-					menu.Menu += " ..."
+				menu.Menu += me.itemText(lm.Items[i])
+				if !enabled {
+					menu.Menu += " (" + reason + ")"
 				}
 				menu.Menu += "\n"
 			}
 		}
 	}
+	if lm.loading != nil && !lm.loading.quiet {
+		menu.Menu += "  " + lm.loading.status() + "\n"
+	}
 	if me.isBackVisible() {
 		if me.ItemCursor == -1 {
 			menu.Menu += "\n-> "
@@ -513,31 +950,32 @@ func (me *MenuEngine) GetRender() *MenuFrame {
 		}
 	}
 
-	return menu.Vars(me)
+	menu.Vars(me)
+	me.renderNotice(menu)
+	return menu
 }
 
-// Vars returns a string formatted with all vars replaced, in order from longest var name to shortest to avoid partial var name replacements
-func (me *MenuEngine) Vars(in string) string {
-	longest := 0
-	vars := make(map[int][]string)
-	for varName := range me.Environment {
-		varLen := len(varName)
-		if varLen > longest {
-			longest = varLen
-		}
-		if _, ok := vars[varLen]; !ok {
-			vars[varLen] = make([]string, 0)
-		}
-		vars[varLen] = append(vars[varLen], varName)
+// Notify shows a notice in the footer until the next input
+func (me *MenuEngine) Notify(notice string) {
+	me.notice = notice
+	me.Redraw()
+}
+
+func (me *MenuEngine) renderNotice(menu *MenuFrame) {
+	if me.notice == "" {
+		return
 	}
-	for i := longest; i > 0; i-- {
-		if varNames, ok := vars[i]; ok {
-			for _, varName := range varNames {
-				in = strings.Replace(in, "$"+varName, me.Environment[varName], -1)
-			}
-		}
+	if menu.Footer != "" {
+		menu.Footer += "\n"
 	}
-	return in
+	menu.Footer += " * " + me.notice
+}
+
+// Vars returns a string with all vars replaced, see Expand for the syntax
+// A reference that fails, such as ${NAME:?message}, is replaced with the error in angle brackets so it shows where it's drawn
+func (me *MenuEngine) Vars(in string) string {
+	out, _ := me.expand(in, true)
+	return out
 }
 
 func (me *MenuEngine) Redraw() {
@@ -547,7 +985,9 @@ func (me *MenuEngine) Redraw() {
 	me.render()
 }
 func (me *MenuEngine) render() {
-	if me.Screen != nil {
+	me.renderMu.Lock()
+	defer me.renderMu.Unlock()
+	if me.Screen != nil && !me.suspended {
 		me.Screen.Render(me.GetRender())
 	}
-}
+}
\ No newline at end of file
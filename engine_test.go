@@ -0,0 +1,108 @@
+package menuify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWithKeepsExitStatus(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{})
+	var res *Result
+	me.Do(func() {
+		me.ChangeMenu("home")
+		res = me.RunWith(`sh -c 'echo out; echo err >&2; exit 3'`, nil)
+	})
+	if res.ExitCode != 3 || string(res.Stdout) != "out\n" || string(res.Stderr) != "err\n" || res.Success() {
+		t.Errorf("exit %d with stdout %q and stderr %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	for name, want := range map[string]string{"EXITCODE": "3", "STDOUT": "out", "STDERR": "err"} {
+		if got, _ := me.GetVar(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	items := me.Menus["home"].Items
+	if len(items) != 1 || items[0].Desc != "Task failed (exit status 3)" {
+		t.Errorf("output notes %+v", items)
+	}
+}
+
+func TestRunWithRoutes(t *testing.T) {
+	me := NewMenuEngine()
+	for _, id := range []string{"home", "passed", "failed"} {
+		me.AddMenu(id, &MenuItemList{})
+	}
+	opts := &ExecOptions{OnSuccess: "passed", OnFailure: "failed"}
+	for _, tt := range []struct{ command, want string }{
+		{"true", "passed"},
+		{"false", "failed"},
+		{"no-such-command-for-menuify", "failed"},
+	} {
+		me.Do(func() {
+			me.ChangeMenu("home")
+			me.RunWith(tt.command, opts)
+		})
+		if me.LoadedMenu != tt.want {
+			t.Errorf("%s went to %q, want %q", tt.command, me.LoadedMenu, tt.want)
+		}
+	}
+}
+
+func TestMenuExecRoutes(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{})
+	me.AddMenu("load", &MenuItemList{Exec: "sh -c 'exit 1'", ExecOpts: &ExecOptions{OnFailure: "failed"}})
+	me.AddMenu("failed", &MenuItemList{})
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.ChangeMenu("load")
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var loaded string
+		me.Do(func() { loaded = me.LoadedMenu })
+		if loaded == "failed" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ended on %q, want failed", loaded)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// suspendScreen records when the engine suspends and resumes it
+type suspendScreen struct {
+	recordScreen
+	me     *MenuEngine
+	events []string
+}
+
+func (ss *suspendScreen) Suspend() {
+	ss.events = append(ss.events, fmt.Sprintf("suspend locked=%t", ss.me.Locked))
+}
+func (ss *suspendScreen) Resume() { ss.events = append(ss.events, "resume") }
+func (ss *suspendScreen) Render(frame *MenuFrame) {
+	ss.recordScreen.Render(frame)
+	ss.events = append(ss.events, "render")
+}
+
+func TestInteractiveHandsOverTerminal(t *testing.T) {
+	me := NewMenuEngine()
+	screen := &suspendScreen{me: me}
+	me.SetScreen(screen)
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{{Text: "Shell", Type: "exec", Action: "true", ExecOpts: &ExecOptions{Interactive: true}}}})
+	me.Do(func() { me.ChangeMenu("home") })
+	screen.events = nil
+
+	me.Action()
+	if got := strings.Join(screen.events, ", "); got != "suspend locked=true, resume, render" {
+		t.Errorf("screen saw %s", got)
+	}
+	if me.Locked {
+		t.Error("input is still locked")
+	}
+}
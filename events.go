@@ -0,0 +1,203 @@
+package menuify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventExecTimeout is how long an exec handler for an event can run for when its exec options don't set a timeout
+var EventExecTimeout = time.Minute
+
+// Events emitted by the engine, to subscribe to with Subscribe or declare exec handlers for in the config
+const (
+	EventMenuEnter    = "menuEnter"    //a menu was entered, including by going back to it
+	EventMenuLeave    = "menuLeave"    //a menu is about to be left
+	EventCursorMove   = "cursorMove"   //the item cursor moved, Item is nil on the go back button
+	EventItemActivate = "itemActivate" //an item was selected, before its action runs
+	EventVarChange    = "varChange"    //a variable changed, with its name, value and previous value
+	EventExecStart    = "execStart"    //a command started, with the command
+	EventExecFinish   = "execFinish"   //a command finished, with the command, exitCode, error, cancelled and timedOut
+	EventError        = "error"        //an error was shown, with the error and its detail
+	EventScreenResize = "screenResize" //the screen changed size, with its width and height
+	EventInputDevice  = "inputDevice"  //an input device was added, removed or failed to open, with the device and its state
+)
+
+// Event describes something that happened in the engine
+type Event struct {
+	Name   string
+	Menu   string            //the loaded menu when the event happened, or the menu entered or left
+	Cursor int               //the item cursor when the event happened
+	Item   *MenuItem         //the item moved to or activated, if any
+	Data   map[string]string //details specific to the event
+}
+
+// EventHandler is called with each event it's subscribed to, with the engine locked so it can use the engine freely
+type EventHandler func(me *MenuEngine, ev *Event)
+
+// EventExec is an exec action declared in the config to run in the background when an event is emitted
+// The event is exported to the command as MENUIFY_EVENT, MENUIFY_MENU, MENUIFY_CURSOR, MENUIFY_ITEM, and MENUIFY_EVENT_<DETAIL> for each detail
+type EventExec struct {
+	Exec     string       `json:"exec,omitempty"`
+	ExecOpts *ExecOptions `json:"execOpts,omitempty"`
+	Menu     string       `json:"menu,omitempty"` //only run for events in this menu, or any menu if empty
+}
+
+type subscription struct {
+	id      int
+	name    string
+	handler EventHandler
+}
+
+// eventBus holds the subscriptions to an engine's events
+type eventBus struct {
+	sync.Mutex
+	subs   []*subscription
+	nextID int
+}
+
+// Subscribe calls a handler for every event with a name, or for every event if the name is "*", and returns an ID to unsubscribe with
+// Handlers run in the order they subscribed
+func (me *MenuEngine) Subscribe(name string, handler EventHandler) int {
+	me.events.Lock()
+	defer me.events.Unlock()
+	me.events.nextID++
+	me.events.subs = append(me.events.subs, &subscription{id: me.events.nextID, name: name, handler: handler})
+	return me.events.nextID
+}
+
+// Unsubscribe removes a subscription by the ID Subscribe returned
+func (me *MenuEngine) Unsubscribe(id int) {
+	me.events.Lock()
+	defer me.events.Unlock()
+	for i, sub := range me.events.subs {
+		if sub.id == id {
+			me.events.subs = append(me.events.subs[:i:i], me.events.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// SubscribeExec runs an exec action in the background for every event with a name, and returns an ID to unsubscribe with
+// Events that come in while the last one's command is still running are skipped, so a burst of them can't pile up processes
+func (me *MenuEngine) SubscribeExec(name string, handler *EventExec) int {
+	var running int32
+	return me.Subscribe(name, func(me *MenuEngine, ev *Event) {
+		if handler.Menu != "" && handler.Menu != ev.Menu {
+			return
+		}
+		if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+			return
+		}
+		cmd, err := me.Command(handler.Exec, handler.ExecOpts)
+		if err != nil {
+			atomic.StoreInt32(&running, 0)
+			return
+		}
+		cmd.Env = append(cmd.Env, ev.Environ()...)
+		if cmd.Timeout == 0 {
+			cmd.Timeout = EventExecTimeout
+		}
+		go func() {
+			cmd.Run() //not runCommand, so handlers for exec events don't set themselves off
+			atomic.StoreInt32(&running, 0)
+		}()
+	})
+}
+
+// Emit calls every handler subscribed to an event, filling in the loaded menu and cursor if the event doesn't have them
+// It needs the engine locked, see Do
+func (me *MenuEngine) Emit(ev *Event) {
+	if ev.Menu == "" {
+		ev.Menu = me.LoadedMenu
+		ev.Cursor = me.ItemCursor
+	}
+	if ev.Data == nil {
+		ev.Data = make(map[string]string)
+	}
+
+	me.events.Lock()
+	handlers := make([]EventHandler, 0, len(me.events.subs))
+	for _, sub := range me.events.subs {
+		if sub.name == ev.Name || sub.name == "*" {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	me.events.Unlock()
+
+	for _, handler := range handlers {
+		handler(me, ev)
+	}
+}
+
+// Environ returns the event as KEY=VALUE pairs for an exec handler
+func (ev *Event) Environ() []string {
+	env := []string{
+		"MENUIFY_EVENT=" + ev.Name,
+		"MENUIFY_MENU=" + ev.Menu,
+		fmt.Sprintf("MENUIFY_CURSOR=%d", ev.Cursor),
+	}
+	if ev.Item != nil {
+		env = append(env, "MENUIFY_ITEM="+ev.Item.Text)
+	}
+	for key, value := range ev.Data {
+		env = append(env, "MENUIFY_EVENT_"+strings.ToUpper(key)+"="+value)
+	}
+	return env
+}
+
+// cursorItem returns the item under the cursor, or nil if the cursor is on the go back button or the menu has a view
+func (me *MenuEngine) cursorItem() *MenuItem {
+	lm, ok := me.Menus[me.LoadedMenu]
+	if !ok || lm == nil || me.ItemCursor < 0 || me.ItemCursor >= len(lm.Items) {
+		return nil
+	}
+	return lm.Items[me.ItemCursor]
+}
+
+// runCommand runs a command, emitting execStart and execFinish around it
+// Set background when calling from a goroutine that doesn't have the engine locked, so the events are emitted through Do
+func (me *MenuEngine) runCommand(ctx context.Context, cmd *Command, background bool) *Result {
+	emit := me.Emit
+	if background {
+		emit = func(ev *Event) {
+			me.Do(func() { me.Emit(ev) })
+		}
+	}
+	command := cmd.String()
+	emit(&Event{Name: EventExecStart, Data: map[string]string{"command": command}})
+	stop := func() {}
+	if !background && cmd.Progress != nil && !cmd.Terminal && cmd.TTY == nil {
+		stop = me.showProgress(cmd.Progress) //the caller is waiting on the command with the engine locked, so nothing else would draw it
+	}
+	res := cmd.RunContext(ctx)
+	stop()
+
+	data := map[string]string{
+		"command":   command,
+		"exitCode":  fmt.Sprintf("%d", res.ExitCode),
+		"cancelled": fmt.Sprintf("%t", res.Cancelled),
+		"timedOut":  fmt.Sprintf("%t", res.TimedOut),
+	}
+	if res.Err != nil {
+		data["error"] = res.Err.Error()
+	}
+	emit(&Event{Name: EventExecFinish, Data: data})
+	return res
+}
+
+// Resize sets the size of the screen in characters, emitting screenResize and redrawing if it changed
+func (me *MenuEngine) Resize(width, height int) {
+	me.stateMu.Lock()
+	defer me.stateMu.Unlock()
+	if width == me.LinesH && height == me.LinesV {
+		return
+	}
+	me.LinesH = width
+	me.LinesV = height
+	me.Emit(&Event{Name: EventScreenResize, Data: map[string]string{"width": fmt.Sprintf("%d", width), "height": fmt.Sprintf("%d", height)}})
+	me.Redraw()
+}
@@ -0,0 +1,89 @@
+package menuify
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmitOrder(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{{Text: "Sub", Type: "menu", Action: "sub"}}})
+	me.AddMenu("sub", &MenuItemList{})
+	var got []string
+	record := func(tag string) EventHandler {
+		return func(me *MenuEngine, ev *Event) { got = append(got, tag+" "+ev.Name+" "+ev.Menu) }
+	}
+	me.Subscribe(EventMenuEnter, record("first"))
+	all := me.Subscribe("*", record("all"))
+	me.Subscribe(EventMenuLeave, record("last"))
+
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.ChangeMenu("sub")
+	})
+	me.Unsubscribe(all)
+	me.Do(me.PrevMenu)
+
+	want := []string{
+		"first menuEnter home", "all menuEnter home",
+		"all menuLeave home", "last menuLeave home",
+		"first menuEnter sub", "all menuEnter sub",
+		"last menuLeave sub",
+		"first menuEnter home",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("handlers ran as\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEventExecSkipsWhileRunning(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	me := NewMenuEngine()
+	me.SetVar("LOG", log)
+	me.SubscribeExec(EventVarChange, &EventExec{Exec: `sh -c 'echo $MENUIFY_EVENT_NAME >> "$LOG"; sleep 0.5'`})
+	me.Do(func() {
+		me.SetVar("A", "1")
+		me.SetVar("B", "2") //the handler for A is still running
+	})
+	time.Sleep(time.Second)
+	me.Do(func() { me.SetVar("C", "3") })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(log)
+		if string(data) == "A\nC\n" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handlers ran for %q, want A and C", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestEventExecTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { EventExecTimeout = timeout }(EventExecTimeout)
+	EventExecTimeout = 200 * time.Millisecond
+	log := filepath.Join(t.TempDir(), "log")
+	me := NewMenuEngine()
+	me.SetVar("LOG", log)
+	me.SubscribeExec(EventVarChange, &EventExec{Exec: `sh -c 'echo $MENUIFY_EVENT_NAME >> "$LOG"; sleep 5'`})
+	me.Do(func() { me.SetVar("A", "1") })
+	time.Sleep(time.Second)
+	me.Do(func() { me.SetVar("B", "2") }) //only runs if the handler for A was stopped
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(log)
+		if string(data) == "A\nB\n" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handlers ran for %q, want A and B", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
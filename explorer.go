@@ -0,0 +1,496 @@
+package menuify
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	rootPrefix = regexp.MustCompile("^[A-Za-z0-9_-]+:")
+)
+
+// ExplorerOptions holds optional settings for an explorer action
+type ExplorerOptions struct {
+	Archives   bool     `json:"archives,omitempty"`   //browse into zip and tar archives as if they were directories, instead of picking them as files
+	Extensions []string `json:"extensions,omitempty"` //only list files with one of these extensions, such as img or .zip
+	Globs      []string `json:"globs,omitempty"`      //only list files whose names match one of these patterns, such as *.img
+	ShowHidden bool     `json:"showHidden,omitempty"` //list dotfiles, otherwise they're hidden until toggled on
+	Sort       string   `json:"sort,omitempty"`       //name (default), size, or mtime, with directories always listed first
+	Reverse    bool     `json:"reverse,omitempty"`    //reverses the sort order
+
+	FileActions bool `json:"fileActions,omitempty"` //selecting a file opens a menu to view, copy, move, rename, delete or inspect it
+	PickDir     bool `json:"pickDir,omitempty"`     //only list directories, to pick one as a destination
+	Viewer      bool `json:"viewer,omitempty"`      //selecting a file opens it in the viewer, unless there's an exec action to pass it to
+	Multi       bool `json:"multi,omitempty"`       //selecting a file toggles a check mark, and a done item returns the checked files one per line, for exec actions to expand with $@NAME
+
+	selection *explorerSelection //the files checked so far, shared by every directory of a multi-select explorer
+	exec      *ExecOptions       //the exec options of the item that opened the explorer, to run its bin with
+}
+
+// explorerSelection holds the files checked in a multi-select explorer, in the order they were checked
+type explorerSelection struct {
+	locations []string
+}
+
+// toggle checks a file if it isn't checked, or unchecks it if it is
+func (sel *explorerSelection) toggle(location string) {
+	for i, selected := range sel.locations {
+		if selected == location {
+			sel.locations = append(sel.locations[:i], sel.locations[i+1:]...)
+			return
+		}
+	}
+	sel.locations = append(sel.locations, location)
+}
+
+func (sel *explorerSelection) has(location string) bool {
+	for _, selected := range sel.locations {
+		if selected == location {
+			return true
+		}
+	}
+	return false
+}
+
+// FileOptions parses the file[:extension1[,extension2,...]] var syntax into explorer options based on opts
+func FileOptions(spec string, opts *ExplorerOptions) *ExplorerOptions {
+	fileOpts := ExplorerOptions{}
+	if opts != nil {
+		fileOpts = *opts
+	}
+	if i := strings.Index(spec, ":"); i >= 0 {
+		fileOpts.Extensions = nil
+		for _, ext := range strings.Split(spec[i+1:], ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				fileOpts.Extensions = append(fileOpts.Extensions, ext)
+			}
+		}
+	}
+	return &fileOpts
+}
+
+// Match returns true if a file name passes the extension and glob filters
+func (opts *ExplorerOptions) Match(name string) bool {
+	if len(opts.Extensions) == 0 && len(opts.Globs) == 0 {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range opts.Extensions {
+		if strings.HasSuffix(lower, "."+strings.TrimPrefix(strings.ToLower(ext), ".")) {
+			return true
+		}
+	}
+	for _, glob := range opts.Globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sort orders explorer entries with directories first, then by the sort key
+func (opts *ExplorerOptions) sort(entries []explorerEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if dirA, dirB := a.IsDir() || a.archive, b.IsDir() || b.archive; dirA != dirB {
+			return dirA
+		}
+		if opts.Reverse {
+			a, b = b, a
+		}
+		if a.info != nil && b.info != nil {
+			switch opts.Sort {
+			case "size":
+				if a.info.Size() != b.info.Size() {
+					return a.info.Size() < b.info.Size()
+				}
+			case "mtime":
+				if !a.info.ModTime().Equal(b.info.ModTime()) {
+					return a.info.ModTime().Before(b.info.ModTime())
+				}
+			}
+		}
+		return strings.ToLower(a.Name()) < strings.ToLower(b.Name())
+	})
+}
+
+// Mount makes a filesystem browsable by explorers at name:/path, or replaces the OS filesystem if name is empty
+func (me *MenuEngine) Mount(name string, fsys fs.FS) {
+	if me.Filesystems == nil {
+		me.Filesystems = make(map[string]fs.FS)
+	}
+	me.Filesystems[name] = fsys
+}
+
+// splitLocation splits an explorer location into the prefix that picks its filesystem and the rooted path within it
+// Locations are /path on the OS filesystem, name:/path on a mounted filesystem, and location!/path inside an archive
+func (me *MenuEngine) splitLocation(location string) (string, string) {
+	if bang := strings.LastIndex(location, "!/"); bang >= 0 {
+		return location[:bang+1], path.Clean(location[bang+1:])
+	}
+	if strings.HasSuffix(location, "!") {
+		return location, "/"
+	}
+	if prefix := rootPrefix.FindString(location); prefix != "" {
+		if _, ok := me.Filesystems[prefix[:len(prefix)-1]]; ok {
+			return prefix, path.Clean("/" + location[len(prefix):])
+		}
+	}
+	return "", path.Clean("/" + location)
+}
+
+// explorerFS returns the filesystem picked by a location prefix from splitLocation
+func (me *MenuEngine) explorerFS(prefix string) (fs.FS, error) {
+	switch {
+	case prefix == "":
+		if fsys, ok := me.Filesystems[""]; ok {
+			return fsys, nil
+		}
+		return OSFS("/"), nil
+	case strings.HasSuffix(prefix, "!"):
+		return me.openArchive(prefix[:len(prefix)-1])
+	}
+	fsys, ok := me.Filesystems[strings.TrimSuffix(prefix, ":")]
+	if !ok {
+		return nil, fmt.Errorf("unknown filesystem: %s", prefix)
+	}
+	return fsys, nil
+}
+
+// openArchive opens the archive at a location as a filesystem, keeping it open for later
+func (me *MenuEngine) openArchive(location string) (fs.FS, error) {
+	me.archivesMu.Lock()
+	defer me.archivesMu.Unlock()
+	if archive, ok := me.archives[location]; ok {
+		return archive, nil
+	}
+
+	prefix, file := me.splitLocation(location)
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := OpenArchive(fsys, fsPath(file))
+	if err != nil {
+		return nil, err
+	}
+	if me.archives == nil {
+		me.archives = make(map[string]fs.FS)
+	}
+	me.archives[location] = archive
+	return archive, nil
+}
+
+// dropArchives closes the archives opened by explorers once there's no explorer left to browse them
+func (me *MenuEngine) dropArchives() {
+	if lm := me.Menus[me.LoadedMenu]; lm != nil && lm.explorer != nil {
+		return
+	}
+	for _, menuID := range me.MenuHistory {
+		if lm := me.Menus[menuID]; lm != nil && lm.explorer != nil {
+			return
+		}
+	}
+
+	me.archivesMu.Lock()
+	defer me.archivesMu.Unlock()
+	for _, archive := range me.archives {
+		if closer, ok := archive.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	me.archives = nil
+}
+
+// fsPath turns a rooted path into the unrooted form io/fs expects
+func fsPath(rooted string) string {
+	unrooted := strings.TrimPrefix(path.Clean("/"+rooted), "/")
+	if unrooted == "" {
+		return "."
+	}
+	return unrooted
+}
+
+// Explorer abuses the powers of AddMenu, ChangeMenu, and PrevMenu to create a file browser with support for passing a selected file to an executable
+func (me *MenuEngine) Explorer(workingDir, bin string) {
+	me.ExplorerWith(workingDir, bin, nil)
+}
+
+// ExplorerWith opens an explorer at a location with explorer options, or the root page of places if the location is empty
+func (me *MenuEngine) ExplorerWith(workingDir, bin string, opts *ExplorerOptions) {
+	if opts == nil {
+		opts = &ExplorerOptions{}
+	}
+	if opts.Multi && opts.selection == nil {
+		multiOpts := *opts
+		multiOpts.selection = &explorerSelection{}
+		opts = &multiOpts
+	}
+	me.enterExplorer()
+	if workingDir == "" {
+		me.ExplorerRoot(bin, opts)
+		return
+	}
+	prefix, dir := me.splitLocation(workingDir)
+	workingDir = prefix + strings.TrimSuffix(dir, "/") + "/"
+	if !opts.PickDir {
+		me.visit(workingDir)
+	}
+
+	displayBin := escapeVars(workingDir)
+	if bin != "" {
+		displayBin = strings.Replace(bin, "$?", escapeVars(workingDir), -1)
+	}
+	explorer := &MenuItemList{
+		Title:    "Explorer - " + displayBin,
+		Items:    make([]*MenuItem, 0),
+		explorer: &explorerState{location: workingDir, bin: bin, opts: opts},
+	}
+	me.listExplorer(explorer)
+
+	menuID := workingDir
+	if opts.PickDir {
+		menuID = "INTERNAL_PICK_DIR " + workingDir //keep the explorer the pick started from intact
+	}
+	me.AddMenu(menuID, explorer)
+	me.ChangeMenu(menuID)
+}
+
+// enterExplorer starts a flow when an explorer is opened from outside of one, so picking a file unwinds the whole explorer
+// A flow started from the same menu, such as for setvar or a copy destination, is used as it is
+func (me *MenuEngine) enterExplorer() {
+	if lm := me.Menus[me.LoadedMenu]; lm != nil && (lm.explorer != nil || me.LoadedMenu == "INTERNAL_EXPLORER_ROOT") {
+		return
+	}
+	if flow := me.InFlow(); flow != nil && flow.depth == len(me.MenuHistory) {
+		return
+	}
+	me.StartFlow("", nil)
+}
+
+// explorerState remembers what an explorer menu lists, so it can be listed again
+type explorerState struct {
+	location string
+	bin      string
+	opts     *ExplorerOptions
+}
+
+// listExplorer fills an explorer menu with the filtered and sorted entries of its location
+func (me *MenuEngine) listExplorer(explorer *MenuItemList) {
+	state := explorer.explorer
+	opts := state.opts
+	explorer.Items = make([]*MenuItem, 0)
+
+	prefix, dir := me.splitLocation(state.location)
+	files, err := me.readDir(prefix, dir)
+	if err != nil {
+		explorer.AddItem("Failed to list the files in "+escapeVars(state.location), escapeVars(err.Error()), "note", "")
+		return
+	}
+
+	if opts.PickDir && me.fileOp != nil {
+		verb := strings.ToUpper(me.fileOp.op[:1]) + me.fileOp.op[1:]
+		explorer.AddItem(verb+" here", escapeVars(verb+" "+path.Base(me.fileOp.location)+" into "+state.location), "return", escapeVars(state.location))
+		if dir != "/" {
+			explorer.Items = append(explorer.Items, &MenuItem{Text: "../", Desc: "Up to the parent folder", Type: "explorer " + escapeVars(prefix+path.Dir(dir)), ExplorerOpts: opts})
+		}
+	}
+
+	if opts.Multi {
+		explorer.AddItem(fmt.Sprintf("Done (%d selected)", len(opts.selection.locations)), "Confirm the selected files", "internal", "explorer done")
+	}
+
+	hidden := false
+	entries := make([]explorerEntry, 0, len(files))
+	for _, file := range files {
+		if opts.PickDir && !file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(file.Name(), ".") {
+			hidden = true
+			if !opts.ShowHidden {
+				continue
+			}
+		}
+		archive := opts.Archives && IsArchive(file.Name())
+		if !file.IsDir() && !archive && !opts.Match(file.Name()) {
+			continue
+		}
+		entry := explorerEntry{DirEntry: file, archive: archive}
+		if info, err := file.Info(); err == nil {
+			entry.info = info
+		}
+		entries = append(entries, entry)
+	}
+	opts.sort(entries)
+
+	//Names and locations are escaped, as items go through Vars
+	for _, entry := range entries {
+		location := state.location + entry.Name()
+		name, loc := escapeVars(entry.Name()), escapeVars(location)
+		switch {
+		case entry.IsDir():
+			explorer.Items = append(explorer.Items, &MenuItem{Text: name + "/", Desc: entry.details(), Type: "explorer " + loc, Action: state.bin, ExplorerOpts: opts})
+		case entry.archive:
+			explorer.Items = append(explorer.Items, &MenuItem{Text: name + "!/", Desc: entry.details(), Type: "explorer " + loc + "!/", Action: state.bin, ExplorerOpts: opts})
+		case opts.Multi:
+			check := "[ ] "
+			if opts.selection.has(location) {
+				check = "[x] "
+			}
+			explorer.AddItem(check+name, entry.details(), "internal", "explorer toggle "+loc)
+		case opts.FileActions:
+			explorer.AddItem(name, entry.details(), "internal", "file menu "+loc)
+		case state.bin == "" && opts.Viewer:
+			explorer.AddItem(name, entry.details(), "view", loc)
+		case state.bin != "":
+			//The bin keeps its vars to be expanded word by word when it runs, with the location put in for $? once it's split
+			explorer.Items = append(explorer.Items, &MenuItem{Text: name, Desc: entry.details(), Type: "exec", Action: state.bin, ExecOpts: opts.exec.withFiles([]string{location})})
+		default:
+			explorer.AddItem(name, entry.details(), "return", loc)
+		}
+	}
+
+	if hidden {
+		if opts.ShowHidden {
+			explorer.AddItem("Hide hidden files", "", "internal", "explorer hidden")
+		} else {
+			explorer.AddItem("Show hidden files", "", "internal", "explorer hidden")
+		}
+	}
+	if opts.FileActions {
+		explorer.AddItem("Folder actions", "Create a folder in here, or act on this folder", "internal", "file menu "+escapeVars(strings.TrimSuffix(state.location, "/")))
+	}
+}
+
+// fileMarker stands in for the explorer's $? while a bin is split into words, as a NUL can't be part of a file name or an argument
+const fileMarker = "\x00"
+
+// substituteFiles puts files in place of the marker in the words split from a bin
+// A word of just $? becomes a word for each file, otherwise the files are joined with spaces within the word
+func substituteFiles(words, files []string) []string {
+	substituted := make([]string, 0, len(words)+len(files))
+	for _, word := range words {
+		if word == fileMarker {
+			substituted = append(substituted, files...)
+			continue
+		}
+		substituted = append(substituted, strings.Replace(word, fileMarker, strings.Join(files, " "), -1))
+	}
+	return substituted
+}
+
+// ExplorerAction runs an action on the loaded explorer, such as toggling hidden files
+// In a multi-select explorer, "toggle <location>" checks or unchecks a file and "done" returns the checked files
+func (me *MenuEngine) ExplorerAction(action string) {
+	explorer, ok := me.Menus[me.LoadedMenu]
+	if !ok || explorer.explorer == nil {
+		me.ErrorText("Not in an explorer", action)
+		return
+	}
+	arg := ""
+	if i := strings.IndexByte(action, ' '); i >= 0 {
+		action, arg = action[:i], action[i+1:]
+	}
+	state := explorer.explorer
+
+	switch action {
+	case "hidden":
+		opts := *state.opts
+		opts.ShowHidden = !opts.ShowHidden
+		state.opts = &opts
+	case "refresh":
+	case "toggle":
+		sel := state.opts.selection
+		if sel == nil {
+			me.ErrorText("Not a multi-select explorer", action)
+			return
+		}
+		sel.toggle(arg)
+		for menuID, lm := range me.Menus {
+			if menuID != me.LoadedMenu && lm != nil && lm.explorer != nil && lm.explorer.opts.selection == sel {
+				me.relistExplorer(menuID) //keep the count on the way back up to date
+			}
+		}
+	case "done":
+		sel := state.opts.selection
+		if sel == nil || len(sel.locations) == 0 {
+			me.Notify("Select at least one file first")
+			return
+		}
+		if state.bin != "" {
+			me.runExec(state.bin, state.opts.exec.withFiles(sel.locations))
+			return
+		}
+		me.ReturnFlow(strings.Join(sel.locations, "\n"))
+		return
+	default:
+		me.ErrorText("Unknown explorer action", action)
+		return
+	}
+
+	me.relistExplorer(me.LoadedMenu)
+	me.Redraw()
+}
+
+// relistExplorer lists an explorer menu's location again, keeping the cursor in bounds if it's loaded
+func (me *MenuEngine) relistExplorer(menuID string) {
+	me.renderMu.Lock()
+	defer me.renderMu.Unlock()
+	explorer, ok := me.Menus[menuID]
+	if !ok || explorer == nil || explorer.explorer == nil {
+		return
+	}
+	me.listExplorer(explorer)
+	if me.LoadedMenu == menuID && me.ItemCursor >= len(explorer.Items) {
+		me.ItemCursor = len(explorer.Items) - 1
+	}
+}
+
+// explorerEntry is a directory entry along with what the explorer knows about it
+type explorerEntry struct {
+	fs.DirEntry
+	info    fs.FileInfo //nil if the entry couldn't be stat'd
+	archive bool        //the entry is browsed into as a directory
+}
+
+// details describes an entry's size and modification time
+func (e explorerEntry) details() string {
+	if e.info == nil {
+		return ""
+	}
+	modTime := e.info.ModTime().Format("2006-01-02 15:04")
+	if e.IsDir() {
+		return "Directory, " + modTime
+	}
+	return FormatSize(e.info.Size()) + ", " + modTime
+}
+
+// FormatSize formats a number of bytes for display, such as 1.5 MiB
+func FormatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	unit := -1
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// readDir lists a directory on the filesystem picked by a location prefix
+func (me *MenuEngine) readDir(prefix, dir string) ([]fs.DirEntry, error) {
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys, fsPath(dir))
+}
@@ -0,0 +1,207 @@
+package menuify
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newExplorerEngine returns an engine on a home menu, with an in-memory filesystem mounted as mem
+func newExplorerEngine(items ...*MenuItem) *MenuEngine {
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{"mem": fstest.MapFS{
+		"a.txt":       {Data: []byte("a")},
+		"sub/b.txt":   {Data: []byte("b")},
+		"sub/c.log":   {Data: []byte("c")},
+		"sub/deep/d":  {Data: []byte("d")},
+		"sub/.hidden": {Data: []byte("h")},
+		"$HOME.txt":   {Data: []byte("$")},
+	}}
+	me.AddMenu("home", &MenuItemList{Items: items})
+	me.HomeMenu = "home"
+	me.ChangeMenu("home")
+	return me
+}
+
+// pick moves the cursor to the first item with a text starting with prefix and selects it
+func pick(t *testing.T, me *MenuEngine, prefix string) {
+	t.Helper()
+	for i, item := range me.Menus[me.LoadedMenu].Items {
+		if strings.HasPrefix(item.Text, prefix) {
+			me.ItemCursor = i
+			me.Action()
+			return
+		}
+	}
+	t.Fatalf("no item %q in %s", prefix, me.LoadedMenu)
+}
+
+func TestExplorerReturnUnwinds(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Browse", Type: "explorer mem:/"})
+	pick(t, me, "Browse")
+	pick(t, me, "sub/")
+	pick(t, me, "deep/")
+	pick(t, me, "d")
+	if me.LoadedMenu != "home" || len(me.MenuHistory) != 0 || me.InFlow() != nil {
+		t.Errorf("ended on %q with history %v", me.LoadedMenu, me.MenuHistory)
+	}
+}
+
+func TestExplorerSetvar(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Pick", Type: "setvar FILE", Action: "file:txt mem:/sub"})
+	pick(t, me, "Pick")
+	texts := make([]string, 0)
+	for _, item := range me.Menus[me.LoadedMenu].Items {
+		texts = append(texts, item.Text)
+	}
+	if strings.Join(texts, ",") != "deep/,b.txt,Show hidden files" {
+		t.Fatalf("listed %q", texts)
+	}
+	pick(t, me, "b.txt")
+	if file, _ := me.GetVar("FILE"); file != "mem:/sub/b.txt" || me.LoadedMenu != "home" {
+		t.Errorf("FILE = %q on %q", file, me.LoadedMenu)
+	}
+}
+
+func TestExplorerMultiDone(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Pick", Type: "setvar FILES", Action: "explorer mem:/", ExplorerOpts: &ExplorerOptions{Multi: true}})
+	pick(t, me, "Pick")
+	pick(t, me, "[ ] a.txt")
+	pick(t, me, "sub/")
+	pick(t, me, "[ ] c.log")
+	pick(t, me, "Done (2 selected)")
+	if files, _ := me.GetVar("FILES"); files != "mem:/a.txt\nmem:/sub/c.log" || me.LoadedMenu != "home" {
+		t.Errorf("FILES = %q on %q", files, me.LoadedMenu)
+	}
+
+	me = newExplorerEngine(&MenuItem{Text: "Pick", Type: "explorer mem:/", ExplorerOpts: &ExplorerOptions{Multi: true}})
+	pick(t, me, "Pick")
+	pick(t, me, "sub/")
+	pick(t, me, "[ ] b.txt")
+	pick(t, me, "Done")
+	if me.LoadedMenu != "home" {
+		t.Errorf("done without a var ended on %q", me.LoadedMenu)
+	}
+}
+
+func TestExplorerBinKeepsWords(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Flash", Type: "explorer mem:/", Action: `flash $TARGET "$?" --in=$?`})
+	me.SetVar("TARGET", "/dev/by name/x")
+	pick(t, me, "Flash")
+	for _, item := range me.Menus[me.LoadedMenu].Items {
+		if item.Text != "a.txt" {
+			continue
+		}
+		cmd, err := me.Command(item.Action, item.ExecOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(cmd.Args, "|"); got != "flash|/dev/by name/x|mem:/a.txt|--in=mem:/a.txt" {
+			t.Errorf("args %q", cmd.Args)
+		}
+		return
+	}
+	t.Fatal("no a.txt item")
+}
+
+func TestExplorerNameWithDollar(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Pick", Type: "setvar FILE", Action: "explorer mem:/"})
+	pick(t, me, "Pick")
+	if !strings.Contains(me.GetRender().Menu, "$HOME.txt") {
+		t.Errorf("rendered %q", me.GetRender().Menu)
+	}
+	pick(t, me, "$$HOME.txt")
+	if file, _ := me.GetVar("FILE"); file != "mem:/$HOME.txt" {
+		t.Errorf("FILE = %q", file)
+	}
+}
+
+func TestExplorerMultiBinUsesExecOpts(t *testing.T) {
+	me := newExplorerEngine(&MenuItem{Text: "Pick", Type: "explorer mem:/", Action: "echo $?", ExplorerOpts: &ExplorerOptions{Multi: true}, ExecOpts: &ExecOptions{Background: true}})
+	pick(t, me, "Pick")
+	pick(t, me, "[ ] a.txt")
+	pick(t, me, "sub/")
+	pick(t, me, "[ ] c.log")
+	pick(t, me, "Done")
+
+	job := me.GetJob(1)
+	if job == nil {
+		t.Fatal("done didn't start a background job")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("job didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if log := job.Pane.Log(); log != "mem:/a.txt mem:/sub/c.log" {
+		t.Errorf("the bin printed %q", log)
+	}
+}
+
+// itemTexts returns the texts of the loaded menu's items
+func itemTexts(me *MenuEngine) []string {
+	texts := make([]string, 0)
+	for _, item := range me.Menus[me.LoadedMenu].Items {
+		texts = append(texts, item.Text)
+	}
+	return texts
+}
+
+func TestExplorerFilterAndHidden(t *testing.T) {
+	me := newExplorerEngine(
+		&MenuItem{Text: "Logs", Type: "explorer mem:/sub", ExplorerOpts: &ExplorerOptions{Extensions: []string{"LOG"}}},
+		&MenuItem{Text: "Globs", Type: "explorer mem:/sub", ExplorerOpts: &ExplorerOptions{Globs: []string{"b.*"}}},
+		&MenuItem{Text: "All", Type: "explorer mem:/sub"},
+	)
+	for _, tt := range []struct{ item, want string }{
+		{"Logs", "deep/|c.log|Show hidden files"},
+		{"Globs", "deep/|b.txt|Show hidden files"},
+		{"All", "deep/|b.txt|c.log|Show hidden files"},
+	} {
+		pick(t, me, tt.item)
+		if got := strings.Join(itemTexts(me), "|"); got != tt.want {
+			t.Errorf("%s listed %q, want %q", tt.item, got, tt.want)
+		}
+		if tt.item != "All" {
+			me.PrevMenu()
+		}
+	}
+	pick(t, me, "Show hidden files")
+	if got := strings.Join(itemTexts(me), "|"); got != "deep/|.hidden|b.txt|c.log|Hide hidden files" {
+		t.Errorf("with hidden files listed %q", got)
+	}
+}
+
+func TestExplorerSort(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{"mem": fstest.MapFS{
+		"big.bin":   {Data: make([]byte, 3000), ModTime: day},
+		"Mid.txt":   {Data: make([]byte, 200), ModTime: day.Add(2 * time.Hour)},
+		"small.txt": {Data: make([]byte, 10), ModTime: day.Add(time.Hour)},
+		"zdir/x":    {Data: []byte("x"), ModTime: day},
+	}}
+	for _, tt := range []struct {
+		opts ExplorerOptions
+		want string
+	}{
+		{ExplorerOptions{}, "zdir/|big.bin|Mid.txt|small.txt"},
+		{ExplorerOptions{Sort: "size"}, "zdir/|small.txt|Mid.txt|big.bin"},
+		{ExplorerOptions{Sort: "mtime", Reverse: true}, "zdir/|Mid.txt|small.txt|big.bin"},
+	} {
+		opts := tt.opts
+		me.ExplorerWith("mem:/", "", &opts)
+		if got := strings.Join(itemTexts(me), "|"); got != tt.want {
+			t.Errorf("sorted by %q reversed %t as %q, want %q", tt.opts.Sort, tt.opts.Reverse, got, tt.want)
+		}
+	}
+	for _, item := range me.Menus[me.LoadedMenu].Items {
+		if item.Text == "big.bin" && item.Desc != "2.9 KiB, 2024-01-01 00:00" {
+			t.Errorf("big.bin described as %q", item.Desc)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package menuify
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExprFuncs holds the functions available to condition expressions, which take and return strings
+var ExprFuncs = map[string]func(args []string) (string, error){
+	"len":   func(args []string) (string, error) { return strconv.Itoa(len([]rune(arg(args, 0)))), nil },
+	"lower": func(args []string) (string, error) { return strings.ToLower(arg(args, 0)), nil },
+	"upper": func(args []string) (string, error) { return strings.ToUpper(arg(args, 0)), nil },
+	"trim":  func(args []string) (string, error) { return strings.TrimSpace(arg(args, 0)), nil },
+	"empty": func(args []string) (string, error) { return exprBool(arg(args, 0) == ""), nil },
+	"contains": func(args []string) (string, error) {
+		return exprBool(strings.Contains(arg(args, 0), arg(args, 1))), nil
+	},
+	"startsWith": func(args []string) (string, error) {
+		return exprBool(strings.HasPrefix(arg(args, 0), arg(args, 1))), nil
+	},
+	"endsWith": func(args []string) (string, error) {
+		return exprBool(strings.HasSuffix(arg(args, 0), arg(args, 1))), nil
+	},
+	"matches": func(args []string) (string, error) {
+		matched, err := regexp.MatchString(arg(args, 1), arg(args, 0))
+		return exprBool(matched), err
+	},
+	"num": func(args []string) (string, error) {
+		n, _ := strconv.ParseFloat(strings.TrimSpace(arg(args, 0)), 64)
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	},
+	"min": func(args []string) (string, error) { return exprFold(args, func(a, b float64) bool { return a < b }) },
+	"max": func(args []string) (string, error) { return exprFold(args, func(a, b float64) bool { return a > b }) },
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+func exprBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func exprFold(args []string, better func(a, b float64) bool) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("needs at least one argument")
+	}
+	best := 0.0
+	for i, value := range args {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("not a number: %q", value)
+		}
+		if i == 0 || better(n, best) {
+			best = n
+		}
+	}
+	return strconv.FormatFloat(best, 'f', -1, 64), nil
+}
+
+// Truthy returns false for an empty string, 0 and false, and true for anything else
+func Truthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false":
+		return false
+	}
+	return true
+}
+
+// Eval evaluates a condition expression against the environment
+// Expressions compare $VARS, ${VARS}, 'strings', "strings" and numbers with == != < <= > >=, combine them with && || ! and parentheses,
+// and call the functions in ExprFuncs, such as contains($MODEL, 'pro') or len($SERIAL) > 0
+// Values that both look like numbers compare as numbers, and anything else compares as text
+func (me *MenuEngine) Eval(expr string) (bool, error) {
+	p := &exprParser{me: me, src: expr}
+	value, err := p.or()
+	if err == nil && p.peek() != "" {
+		err = fmt.Errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", expr, err)
+	}
+	return Truthy(value), nil
+}
+
+// exprParser evaluates an expression as it parses it
+type exprParser struct {
+	me  *MenuEngine
+	src string
+	pos int
+}
+
+// peek returns the next token without consuming it, or an empty string at the end
+func (p *exprParser) peek() string {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return ""
+	}
+	rest := p.src[p.pos:]
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||"} {
+		if strings.HasPrefix(rest, op) {
+			return op
+		}
+	}
+	c := rest[0]
+	switch {
+	case strings.IndexByte("<>!(),", c) >= 0:
+		return string(c)
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(rest[1:], c)
+		if end < 0 {
+			return rest
+		}
+		return rest[:end+2]
+	case c == '$' && strings.HasPrefix(rest, "${"):
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return rest
+		}
+		return rest[:end+1]
+	}
+	end := 1
+	for end < len(rest) && (unicode.IsLetter(rune(rest[end])) || unicode.IsDigit(rune(rest[end])) || strings.IndexByte("_.-", rest[end]) >= 0) {
+		end++
+	}
+	return rest[:end]
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos += len(token)
+	return token
+}
+
+func (p *exprParser) or() (string, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right string
+		right, err = p.and()
+		left = exprBool(Truthy(left) || Truthy(right))
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (string, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right string
+		right, err = p.not()
+		left = exprBool(Truthy(left) && Truthy(right))
+	}
+	return left, err
+}
+
+func (p *exprParser) not() (string, error) {
+	if p.peek() == "!" {
+		p.next()
+		value, err := p.not()
+		return exprBool(!Truthy(value)), err
+	}
+	return p.compare()
+}
+
+func (p *exprParser) compare() (string, error) {
+	left, err := p.primary()
+	if err != nil {
+		return "", err
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.primary()
+	if err != nil {
+		return "", err
+	}
+
+	cmp := strings.Compare(left, right)
+	l, lerr := strconv.ParseFloat(strings.TrimSpace(left), 64)
+	r, rerr := strconv.ParseFloat(strings.TrimSpace(right), 64)
+	if lerr == nil && rerr == nil {
+		cmp = 0
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	}
+	switch op {
+	case "==":
+		return exprBool(cmp == 0), nil
+	case "!=":
+		return exprBool(cmp != 0), nil
+	case "<":
+		return exprBool(cmp < 0), nil
+	case "<=":
+		return exprBool(cmp <= 0), nil
+	case ">":
+		return exprBool(cmp > 0), nil
+	}
+	return exprBool(cmp >= 0), nil
+}
+
+func (p *exprParser) primary() (string, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return "", fmt.Errorf("unexpected end")
+	case token == "(":
+		value, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if p.next() != ")" {
+			return "", fmt.Errorf("missing )")
+		}
+		return value, nil
+	case token[0] == '\'' || token[0] == '"':
+		if len(token) < 2 || token[len(token)-1] != token[0] {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return token[1 : len(token)-1], nil
+	case strings.HasPrefix(token, "${"):
+		if !strings.HasSuffix(token, "}") {
+			return "", fmt.Errorf("unterminated ${")
+		}
+		value, _ := p.me.lookupVar(token[2 : len(token)-1])
+		return value, nil
+	case token[0] == '$':
+		value, _ := p.me.lookupVar(token[1:])
+		return value, nil
+	case token == "true" || token == "false":
+		return token, nil
+	case token[0] == '-' || token[0] == '.' || unicode.IsDigit(rune(token[0])):
+		if _, err := strconv.ParseFloat(token, 64); err != nil {
+			return "", fmt.Errorf("bad number %q", token)
+		}
+		return token, nil
+	}
+
+	fn, ok := ExprFuncs[token]
+	if !ok {
+		return "", fmt.Errorf("unknown name %q", token)
+	}
+	if p.next() != "(" {
+		return "", fmt.Errorf("missing ( after %s", token)
+	}
+	args := make([]string, 0)
+	if p.peek() == ")" {
+		p.next()
+	} else {
+		for {
+			value, err := p.or()
+			if err != nil {
+				return "", err
+			}
+			args = append(args, value)
+			sep := p.next()
+			if sep == ")" {
+				break
+			}
+			if sep != "," {
+				return "", fmt.Errorf("missing ) after the arguments to %s", token)
+			}
+		}
+	}
+	value, err := fn(args)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", token, err)
+	}
+	return value, nil
+}
+
+// itemState evaluates an item's conditions, along with those of the menu a menu item leads to
+// A condition that fails to evaluate disables the item, with the error as the reason
+func (me *MenuEngine) itemState(item *MenuItem) (visible, enabled bool, reason string) {
+	visibleIf, enabledIf, reason := item.VisibleIf, item.EnabledIf, item.DisabledReason
+	if item.Type == "menu" {
+		if lm, ok := me.Menus[me.Vars(item.Action)]; ok && lm != nil {
+			visibleIf = joinConditions(visibleIf, lm.VisibleIf)
+			enabledIf = joinConditions(enabledIf, lm.EnabledIf)
+			if reason == "" {
+				reason = lm.DisabledReason
+			}
+		}
+	}
+
+	visible, enabled = true, true
+	var err error
+	if visibleIf != "" {
+		if visible, err = me.Eval(visibleIf); err != nil {
+			return true, false, "invalid condition: " + err.Error()
+		}
+	}
+	if enabledIf != "" {
+		if enabled, err = me.Eval(enabledIf); err != nil {
+			return visible, false, "invalid condition: " + err.Error()
+		}
+	}
+	if reason == "" {
+		reason = "unavailable"
+	}
+	return visible, enabled, reason
+}
+
+func joinConditions(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return "(" + a + ") && (" + b + ")"
+}
+
+// selectable returns true if the cursor can rest on an item
+func (me *MenuEngine) selectable(item *MenuItem) bool {
+	if item.Type == "divider" {
+		return false
+	}
+	visible, enabled, _ := me.itemState(item)
+	return visible && enabled
+}
+
+// fixCursor moves the cursor off a divider, hidden or disabled item onto the next one it can rest on
+func (me *MenuEngine) fixCursor() {
+	lm := me.Menus[me.LoadedMenu]
+	if lm == nil || lm.View != nil || me.ItemCursor < 0 || me.ItemCursor >= len(lm.Items) {
+		return
+	}
+	for i := 0; i < len(lm.Items); i++ {
+		cursor := (me.ItemCursor + i) % len(lm.Items)
+		if me.selectable(lm.Items[cursor]) {
+			me.ItemCursor = cursor
+			return
+		}
+	}
+	if me.isBackVisible() {
+		me.ItemCursor = -1
+	}
+}
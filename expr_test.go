@@ -0,0 +1,73 @@
+package menuify
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	me := &MenuEngine{Environment: map[string]string{
+		"MODEL":   "Pixel Pro",
+		"BATTERY": "42",
+		"JOBS":    "0",
+		"EMPTY":   "",
+		"VERSION": "10",
+	}}
+	for _, tt := range []struct {
+		expr string
+		want bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"$BATTERY", true},
+		{"$JOBS", false},
+		{"$EMPTY", false},
+		{"$UNSET", false},
+		{"!$EMPTY", true},
+		{"$BATTERY > 20", true},
+		{"$BATTERY >= 42 && $BATTERY <= 42", true},
+		{"$VERSION > 9", true},  //numbers compare as numbers
+		{"'10' > '9'", true},    //even when quoted
+		{"'abc' < 'abd'", true}, //text compares as text
+		{"$MODEL == 'Pixel Pro'", true},
+		{`${MODEL} != "Pixel Pro"`, false},
+		{"$JOBS == 0 || $BATTERY < 10", true},
+		{"!($JOBS == 0 || $BATTERY < 10)", false},
+		{"!!$BATTERY", true},
+		{"$EMPTY || $UNSET && true", false},
+		{"true || false && false", true},
+		{"contains($MODEL, 'Pro')", true},
+		{"contains(lower($MODEL), 'pro') && startsWith($MODEL, 'Pix')", true},
+		{"endsWith($MODEL, 'Max')", false},
+		{"len($MODEL) == 9", true},
+		{"len($UNSET) > 0", false},
+		{"empty($EMPTY)", true},
+		{"matches($BATTERY, '^[0-9]+$')", true},
+		{"max($BATTERY, 50, 7) == 50", true},
+		{"min(3, -1.5) == -1.5", true},
+		{"num(' 007 ') == 7", true},
+		{"upper(trim('  a ')) == 'A'", true},
+	} {
+		got, err := me.Eval(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("Eval(%q) = %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"$BATTERY >",
+		"($BATTERY > 1",
+		"'unterminated",
+		"${MODEL",
+		"nope($MODEL)",
+		"len $MODEL",
+		"contains($MODEL 'Pro')",
+		"max()",
+		"min('a', 1)",
+		"matches($MODEL, '[')",
+		"1.2.3 > 1",
+		"true false",
+	} {
+		if _, err := me.Eval(expr); err == nil {
+			t.Errorf("Eval(%q) didn't fail", expr)
+		}
+	}
+}
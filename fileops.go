@@ -0,0 +1,512 @@
+package menuify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var (
+	// LargeCopy is the size in bytes above which copies run in the background with a progress bar
+	LargeCopy int64 = 16 * 1024 * 1024
+)
+
+// WritableFS is a filesystem that explorer file actions can change
+type WritableFS interface {
+	fs.FS
+	Create(name string) (io.WriteCloser, error)
+	Mkdir(name string, perm fs.FileMode) error
+	Rename(oldname, newname string) error
+	RemoveAll(name string) error
+}
+
+// OSFS is the OS filesystem rooted at a directory, as a WritableFS
+type OSFS string
+
+func (root OSFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(root), filepath.FromSlash(name)), nil
+}
+
+func (root OSFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(root)).Open(name)
+}
+
+func (root OSFS) Create(name string) (io.WriteCloser, error) {
+	file, err := root.path("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(file)
+}
+
+func (root OSFS) Mkdir(name string, perm fs.FileMode) error {
+	dir, err := root.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(dir, perm)
+}
+
+func (root OSFS) Rename(oldname, newname string) error {
+	oldpath, err := root.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := root.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+func (root OSFS) RemoveAll(name string) error {
+	file, err := root.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(file)
+}
+
+// fileOp is a file action in progress, started from an explorer's file actions menu
+type fileOp struct {
+	location string //the file or directory being acted on
+	op       string //copy or move while picking a destination
+	explorer string //menuID of the explorer the action started from
+	flow     *Flow  //the flow of the file actions menu, unwinding to the explorer
+	gone     bool   //the action took the file away, so an explorer showing it has to be left
+}
+
+// FileMenu generates a file actions menu for a location with menuID "INTERNAL_FILE" and navigates to it
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) FileMenu(location string) {
+	me.fileOp = &fileOp{location: location, explorer: me.LoadedMenu}
+	me.fileOp.flow = me.StartFlow("", nil)
+	prefix, file := me.splitLocation(location)
+
+	menu := &MenuItemList{
+		Title:    "File actions - " + escapeVars(location),
+		Subtitle: "Act on " + escapeVars(path.Base(file)),
+		Items:    make([]*MenuItem, 0),
+	}
+	if info, err := me.stat(prefix, file); err == nil && info.IsDir() {
+		menu.Subtitle = "Act on the folder " + escapeVars(path.Base(file))
+		menu.AddItem("New folder", "Create a folder in here", "internal", "file mkdir")
+	} else {
+		menu.AddItem("View", "Page through the file as text, or as a hex dump if it's binary", "internal", "file view")
+		menu.AddItem("Follow", "Keep showing what's written to the end of the file, like a log", "internal", "file follow")
+		menu.AddItem("Verify checksum", "Compare against a .sha256, .sha1 or .md5 file next to it", "internal", "file checksum")
+	}
+	menu.AddItem("Properties", "Show the size, permissions and modification time", "internal", "file properties")
+	if file != "/" {
+		menu.AddItem("Copy", "Copy to another folder", "internal", "file copy")
+		menu.AddItem("Move", "Move to another folder", "internal", "file move")
+		menu.AddItem("Rename", "Give a new name", "internal", "file rename")
+		menu.AddItem("Delete", "Delete permanently", "internal", "file delete")
+	}
+	me.AddMenu("INTERNAL_FILE", menu)
+	me.ChangeMenu("INTERNAL_FILE")
+}
+
+// FileAction runs an action from a file actions menu
+func (me *MenuEngine) FileAction(action string) {
+	op := me.fileOp
+	if op == nil {
+		me.ErrorText("No file to act on", action)
+		return
+	}
+	prefix, file := me.splitLocation(op.location)
+	name := path.Base(file)
+
+	switch action {
+	case "properties":
+		me.fileProperties(op.location)
+	case "view", "follow":
+		me.ViewFile(op.location, action == "follow")
+	case "checksum":
+		me.Checksum(op.location, "", "")
+	case "mkdir":
+		me.Input("New folder in "+escapeVars(op.location), "Name", "", func(me *MenuEngine, value string) {
+			if err := checkName(value); err != nil {
+				me.Notify(err.Error())
+				return
+			}
+			me.fileDone(me.mkdir(prefix, path.Join(file, value)), "Created "+value)
+		})
+	case "rename":
+		me.Input("Rename "+escapeVars(op.location), "Name", name, func(me *MenuEngine, value string) {
+			if err := checkName(value); err != nil {
+				me.Notify(err.Error())
+				return
+			}
+			if value == name {
+				me.fileDone(nil, "")
+				return
+			}
+			target := path.Join(path.Dir(file), value)
+			me.confirmReplace(prefix, target, func(me *MenuEngine) {
+				op.gone = true
+				me.fileDone(me.rename(prefix, file, target), "Renamed to "+value)
+			})
+		})
+	case "delete":
+		me.Confirm("Delete - "+escapeVars(op.location), "Delete "+name+" permanently?", "Delete", func(me *MenuEngine) {
+			fsys, err := me.writableFS(prefix)
+			if err == nil {
+				err = fsys.RemoveAll(fsPath(file))
+			}
+			op.gone = true
+			me.fileDone(err, "Deleted "+name)
+		})
+	case "copy", "move":
+		if action == "move" {
+			if _, err := me.writableFS(prefix); err != nil {
+				me.Notify("Can't move " + name + ": " + err.Error())
+				return
+			}
+		}
+		op.op = action
+		opts := &ExplorerOptions{PickDir: true}
+		if explorer := me.fileExplorer(); explorer != nil {
+			pickOpts := *explorer.explorer.opts
+			pickOpts.PickDir = true
+			pickOpts.FileActions = false
+			opts = &pickOpts
+		}
+		me.StartFlow("", func(me *MenuEngine, dest string) {
+			destPrefix, destDir := me.splitLocation(dest)
+			target := path.Join(destDir, name)
+			if destPrefix == prefix && (target == file || strings.HasPrefix(destDir+"/", file+"/")) {
+				me.Notify("Can't " + op.op + " " + name + " into itself")
+				return
+			}
+			if destPrefix == prefix && strings.HasPrefix(file+"/", target+"/") {
+				me.Notify("Can't replace " + path.Base(target) + " with something inside it")
+				return
+			}
+			me.confirmReplace(destPrefix, target, func(me *MenuEngine) {
+				me.paste(op, prefix, file, destPrefix, target)
+			})
+		})
+		me.ExplorerWith(prefix+path.Dir(file), "", opts)
+	default:
+		me.ErrorText("Unknown file action", action)
+	}
+}
+
+// fileDone returns to the explorer a file action started from and lists it again, noting how the action went
+func (me *MenuEngine) fileDone(err error, notice string) {
+	op := me.fileOp
+	if op == nil || me.InFlow() != op.flow {
+		return //the file actions menu was backed out of
+	}
+	me.ReturnFlow("")
+	me.fileOp = nil
+	if lm, ok := me.Menus[me.LoadedMenu]; ok && lm.explorer != nil {
+		if op.gone && err == nil && lm.explorer.location == op.location+"/" {
+			me.PrevMenu() //the action was on the folder being shown, which isn't there anymore
+		}
+		if lm, ok := me.Menus[me.LoadedMenu]; ok && lm.explorer != nil {
+			me.ExplorerAction("refresh")
+		}
+	}
+	if err != nil {
+		me.Notify("Failed: " + err.Error())
+	} else if notice != "" {
+		me.Notify(notice)
+	}
+}
+
+// confirmReplace asks before replacing a file that's in the way of an action, or just carries on if there isn't one
+// The file in the way is only replaced once the action has its replacement ready, see swapIn
+func (me *MenuEngine) confirmReplace(prefix, target string, done func(me *MenuEngine)) {
+	if _, err := me.stat(prefix, target); err != nil {
+		done(me)
+		return
+	}
+	me.Confirm("Replace - "+escapeVars(prefix+target), path.Base(target)+" already exists, replace it?", "Replace", done)
+}
+
+// sideName returns a hidden name next to a file for a copy in progress or a file about to be replaced
+func sideName(name, suffix string) string {
+	return path.Join(path.Dir(name), "."+path.Base(name)+".menuify-"+suffix)
+}
+
+// swapIn renames a file over a target, keeping anything already there until the file has taken its place
+func swapIn(fsys WritableFS, file, target string) error {
+	old := sideName(target, "old")
+	fsys.RemoveAll(old)
+	kept := true
+	if err := fsys.Rename(target, old); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		kept = false
+	}
+	if err := fsys.Rename(file, target); err != nil {
+		if kept {
+			fsys.Rename(old, target)
+		}
+		return err
+	}
+	if kept {
+		return fsys.RemoveAll(old)
+	}
+	return nil
+}
+
+// paste finishes a copy or move into a picked destination, copying large trees in the background
+func (me *MenuEngine) paste(op *fileOp, prefix, file, destPrefix, target string) {
+	name := path.Base(file)
+	op.gone = op.op == "move"
+	if op.op == "move" && destPrefix == prefix {
+		//A rename can't cross the mounts within a filesystem, so those moves fall back to copying and removing
+		if err := me.rename(prefix, file, target); !errors.Is(err, syscall.EXDEV) {
+			me.fileDone(err, "Moved "+name)
+			return
+		}
+	}
+
+	src, err := me.explorerFS(prefix)
+	if err != nil {
+		me.fileDone(err, "")
+		return
+	}
+	dst, err := me.writableFS(destPrefix)
+	if err != nil {
+		me.fileDone(err, "")
+		return
+	}
+	total, err := treeSize(src, fsPath(file))
+	if err != nil {
+		me.fileDone(err, "")
+		return
+	}
+
+	verb, done := "Copying", "Copied "+name
+	if op.op == "move" {
+		verb, done = "Moving", "Moved "+name
+	}
+	transfer := func(progress *Progress, log io.Writer) error {
+		//Copy beside the target, so a failed copy leaves whatever it was replacing alone
+		partial := sideName(fsPath(target), "partial")
+		dst.RemoveAll(partial)
+		err := copyTree(src, fsPath(file), dst, partial, total, progress, log)
+		if err == nil {
+			err = swapIn(dst, partial, fsPath(target))
+		}
+		if err != nil {
+			dst.RemoveAll(partial)
+		}
+		if err == nil && op.op == "move" {
+			var from WritableFS
+			if from, err = me.writableFS(prefix); err == nil {
+				err = from.RemoveAll(fsPath(file))
+			}
+		}
+		return err
+	}
+	if total < LargeCopy {
+		me.fileDone(transfer(&Progress{}, io.Discard), done)
+		return
+	}
+
+	me.fileDone(nil, "")
+	explorer := me.LoadedMenu
+	me.RunTask(verb+" "+escapeVars(name), func(progress *Progress, log io.Writer) error {
+		err := transfer(progress, log)
+		if err == nil {
+			fmt.Fprintln(log, done)
+		}
+		me.Do(func() { me.relistExplorer(explorer) })
+		return err
+	})
+}
+
+// fileExplorer returns the explorer a file action started from, if it's still around
+func (me *MenuEngine) fileExplorer() *MenuItemList {
+	if me.fileOp == nil {
+		return nil
+	}
+	explorer, ok := me.Menus[me.fileOp.explorer]
+	if !ok || explorer == nil || explorer.explorer == nil {
+		return nil
+	}
+	return explorer
+}
+
+// rename moves a file within the filesystem picked by a location prefix, replacing anything at the target once it's moved
+func (me *MenuEngine) rename(prefix, file, target string) error {
+	fsys, err := me.writableFS(prefix)
+	if err != nil {
+		return err
+	}
+	return swapIn(fsys, fsPath(file), fsPath(target))
+}
+
+// mkdir creates a directory on the filesystem picked by a location prefix
+func (me *MenuEngine) mkdir(prefix, dir string) error {
+	fsys, err := me.writableFS(prefix)
+	if err != nil {
+		return err
+	}
+	return fsys.Mkdir(fsPath(dir), 0755)
+}
+
+// fileProperties shows what's known about a file in a menu with menuID "INTERNAL_FILE_PROPERTIES"
+func (me *MenuEngine) fileProperties(location string) {
+	prefix, file := me.splitLocation(location)
+	menu := &MenuItemList{
+		Title: "Properties - " + escapeVars(location),
+		Items: make([]*MenuItem, 0),
+	}
+
+	info, err := me.stat(prefix, file)
+	if err != nil {
+		menu.AddItem("Failed to read the properties", escapeVars(err.Error()), "note", "")
+	} else {
+		kind := "File"
+		size := FormatSize(info.Size())
+		if info.IsDir() {
+			kind = "Folder"
+			if fsys, err := me.explorerFS(prefix); err == nil {
+				if total, err := treeSize(fsys, fsPath(file)); err == nil {
+					size = FormatSize(total) + " in total"
+				}
+			}
+		}
+		menu.AddItem("Name: "+escapeVars(path.Base(file)), "", "note", "")
+		menu.AddItem("Type: "+kind, "", "note", "")
+		menu.AddItem("Size: "+size, fmt.Sprintf("%d bytes", info.Size()), "note", "")
+		menu.AddItem("Permissions: "+info.Mode().String(), "", "note", "")
+		menu.AddItem("Modified: "+info.ModTime().Format("2006-01-02 15:04:05"), "", "note", "")
+	}
+	me.AddMenu("INTERNAL_FILE_PROPERTIES", menu)
+	me.ChangeMenu("INTERNAL_FILE_PROPERTIES")
+}
+
+// writableFS returns the filesystem picked by a location prefix if file actions can change it
+func (me *MenuEngine) writableFS(prefix string) (WritableFS, error) {
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		return nil, err
+	}
+	writable, ok := fsys.(WritableFS)
+	if !ok {
+		return nil, fmt.Errorf("%s is read-only", strings.TrimSuffix(prefix+"/", "!"))
+	}
+	return writable, nil
+}
+
+// stat returns information about a file on the filesystem picked by a location prefix
+func (me *MenuEngine) stat(prefix, file string) (fs.FileInfo, error) {
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(fsys, fsPath(file))
+}
+
+// checkName returns an error if a name can't be used for a new file
+func checkName(name string) error {
+	switch {
+	case name == "", name == ".", name == "..":
+		return fmt.Errorf("Invalid name: %q", name)
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("Names can't contain /")
+	}
+	return nil
+}
+
+// treeSize adds up the size of a file, or every file in a directory
+func treeSize(fsys fs.FS, root string) (int64, error) {
+	var total int64
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// copyTree copies a file or directory between filesystems, reporting progress against the total size
+func copyTree(src fs.FS, root string, dst WritableFS, target string, total int64, progress *Progress, log io.Writer) error {
+	var copied int64
+	return fs.WalkDir(src, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		to := target
+		if name != root {
+			to = path.Join(target, strings.TrimPrefix(name, root+"/"))
+		}
+
+		switch {
+		case d.IsDir():
+			if err := dst.Mkdir(to, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		case d.Type().IsRegular():
+			fmt.Fprintln(log, name)
+			progress.SetStatus(path.Base(name))
+			if err := copyFile(src, name, dst, to, &progressReader{progress: progress, done: &copied, total: total}); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintln(log, "Skipped "+name)
+		}
+		return nil
+	})
+}
+
+// copyFile copies a single file between filesystems through a progress reader, closing both ends before returning
+func copyFile(src fs.FS, name string, dst WritableFS, to string, pr *progressReader) error {
+	in, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dst.Create(to)
+	if err != nil {
+		return err
+	}
+	pr.r = in
+	_, err = io.Copy(out, pr)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// progressReader reports how much of a total has been read
+type progressReader struct {
+	r        io.Reader
+	progress *Progress
+	done     *int64
+	total    int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	*pr.done += int64(n)
+	if pr.total > 0 {
+		pr.progress.Set(float64(*pr.done) / float64(pr.total) * 100)
+	}
+	return n, err
+}
@@ -0,0 +1,179 @@
+package menuify
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS tracks how many of its files are open at once
+type countingFS struct {
+	fs.FS
+	open, most int
+}
+
+type countedFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && !info.IsDir() {
+		c.open++
+		if c.open > c.most {
+			c.most = c.open
+		}
+		return &countedFile{File: f, fsys: c}, nil
+	}
+	return f, nil
+}
+
+func (f *countedFile) Close() error {
+	f.fsys.open--
+	return f.File.Close()
+}
+
+func TestCopyTreeClosesFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", i)), []byte("data"), 0644)
+	}
+	src := &countingFS{FS: OSFS(dir)}
+	dst := OSFS(t.TempDir())
+
+	if err := copyTree(src, ".", dst, "copy", 0, &Progress{}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if src.most != 1 || src.open != 0 {
+		t.Errorf("had %d files open at once, %d left open", src.most, src.open)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(string(dst), "copy", "f19")); err != nil || string(data) != "data" {
+		t.Errorf("copied %q, %v", data, err)
+	}
+}
+
+// crossFS is an OSFS with a mount in each top level folder, which can't rename between them
+type crossFS struct{ OSFS }
+
+func (c crossFS) Rename(oldname, newname string) error {
+	if strings.SplitN(oldname, "/", 2)[0] != strings.SplitN(newname, "/", 2)[0] {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return c.OSFS.Rename(oldname, newname)
+}
+
+func TestPasteMoveAcrossMounts(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "m1", "from"), 0755)
+	os.MkdirAll(filepath.Join(dir, "m2"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "m1", "from", "a.txt"), []byte("a"), 0644)
+
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{"disk": crossFS{OSFS(dir)}}
+	me.paste(&fileOp{op: "move"}, "disk:", "/m1/from", "disk:", "/m2/to")
+
+	if _, err := os.Stat(filepath.Join(dir, "m1", "from")); !os.IsNotExist(err) {
+		t.Errorf("source still there: %v", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "m2", "to", "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("moved %q, %v", data, err)
+	}
+}
+
+func TestMoveOntoItsParentRefused(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a", "x", "x"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a", "x", "x", "keep"), []byte("k"), 0644)
+
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{"disk": OSFS(dir)}
+	me.AddMenu("home", &MenuItemList{})
+	me.ChangeMenu("home")
+	me.FileMenu("disk:/a/x/x")
+	me.FileAction("move")
+	me.ReturnFlow("disk:/a")
+
+	if _, err := os.Stat(filepath.Join(dir, "a", "x", "x", "keep")); err != nil {
+		t.Fatalf("source lost: %v", err)
+	}
+	if !strings.HasPrefix(me.notice, "Can't replace") {
+		t.Errorf("notice %q", me.notice)
+	}
+}
+
+// failingFS fails to open one file, to break a copy part of the way through
+type failingFS struct {
+	fs.FS
+	fail string
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if name == f.fail {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.FS.Open(name)
+}
+
+func TestFailedCopyKeepsReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "f"), []byte("old"), 0644)
+
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{
+		"disk": OSFS(dir),
+		"src":  failingFS{FS: fstest.MapFS{"f/a": {Data: []byte("a")}, "f/b": {Data: []byte("b")}}, fail: "f/b"},
+	}
+	me.paste(&fileOp{op: "copy"}, "src:", "/f", "disk:", "/f")
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "f")); err != nil || string(data) != "old" {
+		t.Errorf("replaced file is now %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+
+	me.Filesystems["src"] = fstest.MapFS{"f/a": {Data: []byte("a")}}
+	me.paste(&fileOp{op: "copy"}, "src:", "/f", "disk:", "/f")
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "f", "a")); err != nil || string(data) != "a" {
+		t.Errorf("copied %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
+
+func TestMoveFromReadOnlyRefused(t *testing.T) {
+	me := newExplorerEngine()
+	me.FileMenu("mem:/a.txt")
+	me.FileAction("move")
+	if me.LoadedMenu != "INTERNAL_FILE" || !strings.HasPrefix(me.notice, "Can't move") {
+		t.Errorf("on %s with notice %q", me.LoadedMenu, me.notice)
+	}
+}
+
+func TestFileMenuShowsDollarNames(t *testing.T) {
+	me := NewMenuEngine()
+	me.Filesystems = map[string]fs.FS{"mem": fstest.MapFS{"pay$HOME.txt": {Data: []byte("x")}}}
+	me.SetVar("HOME", "/home/user")
+	me.AddMenu("home", &MenuItemList{})
+	me.ChangeMenu("home")
+	me.FileMenu("mem:/pay$HOME.txt")
+	if header := me.GetRender().Header; !strings.Contains(header, "File actions - mem:/pay$HOME.txt\n\nAct on pay$HOME.txt") {
+		t.Errorf("file menu header %q", header)
+	}
+	me.FileAction("properties")
+	if frame := me.GetRender(); !strings.Contains(frame.Header, "mem:/pay$HOME.txt") || !strings.Contains(frame.Menu, "Name: pay$HOME.txt") {
+		t.Errorf("properties drew %q and %q", frame.Header, frame.Menu)
+	}
+}
@@ -0,0 +1,74 @@
+package menuify
+
+// Flow is a modal sub-flow, such as a picker, an explorer or a text input, that returns a value to where it started
+type Flow struct {
+	Var  string                             //the variable the value is returned into, if any
+	Done func(me *MenuEngine, value string) //called after returning, once the menus are back where the flow started
+
+	depth int //length of the menu history when the flow started
+}
+
+// StartFlow starts a sub-flow from the loaded menu, to be followed by navigating into the flow's first menu
+// Leaving the flow with ReturnFlow or CancelFlow unwinds to exactly the menu and item the flow started from
+// Going back past the first menu cancels the flow
+func (me *MenuEngine) StartFlow(varName string, done func(me *MenuEngine, value string)) *Flow {
+	flow := &Flow{
+		Var:   varName,
+		Done:  done,
+		depth: len(me.MenuHistory),
+	}
+	me.flows = append(me.flows, flow)
+	return flow
+}
+
+// InFlow returns the innermost flow in progress, or nil if there isn't one
+func (me *MenuEngine) InFlow() *Flow {
+	if len(me.flows) == 0 {
+		return nil
+	}
+	return me.flows[len(me.flows)-1]
+}
+
+// ReturnFlow leaves the innermost flow with a value, storing it in the flow's variable before calling its Done
+// Without a flow in progress, it just goes back to the previous menu
+func (me *MenuEngine) ReturnFlow(value string) {
+	flow := me.endFlow()
+	if flow == nil {
+		me.PrevMenu()
+		return
+	}
+	if flow.Var != "" {
+		me.SetVar(flow.Var, value)
+	}
+	if flow.Done != nil {
+		flow.Done(me, value)
+	}
+}
+
+// CancelFlow leaves the innermost flow without a value
+// Without a flow in progress, it just goes back to the previous menu
+func (me *MenuEngine) CancelFlow() {
+	if me.endFlow() == nil {
+		me.PrevMenu()
+	}
+}
+
+// endFlow pops the innermost flow and unwinds the menu history to where it started
+func (me *MenuEngine) endFlow() *Flow {
+	flow := me.InFlow()
+	if flow == nil {
+		return nil
+	}
+	me.flows = me.flows[:len(me.flows)-1]
+	for len(me.MenuHistory) > flow.depth {
+		me.PrevMenu()
+	}
+	return flow
+}
+
+// dropFlows cancels any flows that were backed out of, after going back to the menu they started from
+func (me *MenuEngine) dropFlows() {
+	for len(me.flows) > 0 && me.flows[len(me.flows)-1].depth >= len(me.MenuHistory) {
+		me.flows = me.flows[:len(me.flows)-1]
+	}
+}
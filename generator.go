@@ -0,0 +1,175 @@
+package menuify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JoshuaDoes/json"
+)
+
+// MenuGenerator fills a menu with items described by the output of a command, such as a list of block devices or backups
+type MenuGenerator struct {
+	Exec     string       `json:"exec,omitempty"`     //command that prints the items
+	ExecOpts *ExecOptions `json:"execOpts,omitempty"` //options for the command
+	Format   string       `json:"format,omitempty"`   //json (default) for an array of items, or lines for one text|desc|type|action|key item per line
+	Refresh  string       `json:"refresh,omitempty"`  //entry (default) regenerates each time the menu is entered, once only generates the first time, or an interval such as 10s also regenerates while the menu is open
+}
+
+// interval returns the parsed refresh interval, or 0 if the generator doesn't refresh on a timer
+func (mg *MenuGenerator) interval() time.Duration {
+	switch mg.Refresh {
+	case "", "entry", "once":
+		return 0
+	}
+	interval, err := time.ParseDuration(mg.Refresh)
+	if err != nil || interval <= 0 {
+		return 0
+	}
+	return interval
+}
+
+// ParseItems parses menu items printed by a generator in the given format
+func ParseItems(output []byte, format string) ([]*MenuItem, error) {
+	items := make([]*MenuItem, 0)
+	switch format {
+	case "", "json":
+		if err := json.Unmarshal(output, &items); err != nil {
+			return nil, fmt.Errorf("error decoding items: %v", err)
+		}
+		for i := 0; i < len(items); i++ {
+			if items[i] == nil {
+				return nil, fmt.Errorf("item %d is null", i)
+			}
+		}
+	case "lines":
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" || line[0] == '#' {
+				continue
+			}
+			fields := strings.SplitN(line, "|", 5)
+			for len(fields) < 5 {
+				fields = append(fields, "")
+			}
+			item := &MenuItem{Text: fields[0], Desc: fields[1], Type: fields[2], Action: fields[3], Key: fields[4]}
+			if item.Type == "" {
+				item.Type = "note"
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("unknown item format: %s", format)
+	}
+	return items, nil
+}
+
+// itemKey returns the key that identifies an item across refreshes
+func itemKey(item *MenuItem) string {
+	if item.Key != "" {
+		return item.Key
+	}
+	return item.Type + "\x00" + item.Action + "\x00" + item.Text
+}
+
+// Refresh regenerates the loaded menu's items if it has a generator, or lists an explorer's location again
+func (me *MenuEngine) Refresh() {
+	lm, ok := me.Menus[me.LoadedMenu]
+	if ok && lm != nil && lm.explorer != nil {
+		me.ExplorerAction("refresh")
+		return
+	}
+	if !ok || lm == nil || lm.Generator == nil {
+		me.Redraw()
+		return
+	}
+	me.cancelLoad()
+	me.generate(me.LoadedMenu, lm, false)
+	me.Redraw()
+}
+
+// enterGenerator regenerates a menu's items when it's entered, unless quiet is set this shows the loading indicator
+func (me *MenuEngine) enterGenerator(menuID string, lm *MenuItemList, quiet bool) {
+	if lm.Generator.Refresh != "once" || lm.configured == nil {
+		me.generate(menuID, lm, quiet)
+	}
+	me.watchGenerator(menuID, lm)
+}
+
+// generate runs a menu's generator in the background, replacing any items it generated before
+func (me *MenuEngine) generate(menuID string, lm *MenuItemList, quiet bool) {
+	gen := lm.Generator
+	me.startLoad(menuID, lm, gen.Exec, gen.ExecOpts, quiet, func(cmd *Command, res *Result) {
+		var items []*MenuItem
+		err := me.ApplyResult(res, gen.ExecOpts)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("failed to parse output: %v", err)
+		case res.TimedOut:
+			err = fmt.Errorf("timed out after %s", cmd.Timeout)
+		case res.Err != nil:
+			err = res.Err
+		default:
+			items, err = ParseItems(res.Stdout, gen.Format)
+		}
+		if err != nil {
+			items = []*MenuItem{{Text: "Failed to generate items: " + err.Error(), Desc: tailLines(string(res.Stderr), 1), Type: "note"}}
+		}
+		me.setGenerated(menuID, lm, items)
+	})
+}
+
+// setGenerated replaces a menu's generated items, keeping the cursor on the same item if it's still there
+func (me *MenuEngine) setGenerated(menuID string, lm *MenuItemList, items []*MenuItem) {
+	me.renderMu.Lock()
+	loaded := me.LoadedMenu == menuID
+	selected := ""
+	if loaded && me.ItemCursor >= 0 && me.ItemCursor < len(lm.Items) {
+		selected = itemKey(lm.Items[me.ItemCursor])
+	}
+
+	if lm.configured == nil {
+		lm.configured = lm.Items
+	}
+	lm.Items = append(lm.configured[:len(lm.configured):len(lm.configured)], items...)
+
+	if loaded && selected != "" {
+		me.ItemCursor = lm.DefaultCur
+		for i := 0; i < len(lm.Items); i++ {
+			if itemKey(lm.Items[i]) == selected {
+				me.ItemCursor = i
+				break
+			}
+		}
+	}
+	if loaded && me.ItemCursor >= len(lm.Items) {
+		me.ItemCursor = len(lm.Items) - 1
+	}
+	me.renderMu.Unlock()
+	me.render()
+}
+
+// watchGenerator regenerates a menu's items on its refresh interval for as long as it stays loaded
+func (me *MenuEngine) watchGenerator(menuID string, lm *MenuItemList) {
+	interval := lm.Generator.interval()
+	if interval == 0 || lm.watching {
+		return
+	}
+	lm.watching = true
+
+	go func() {
+		for left := false; !left; {
+			time.Sleep(interval)
+			me.Do(func() {
+				if me.LoadedMenu != menuID {
+					lm.watching = false
+					left = true
+					return
+				}
+				if lm.loading == nil {
+					me.generate(menuID, lm, true)
+				}
+			})
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package menuify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseItems(t *testing.T) {
+	for _, tt := range []struct {
+		output, format string
+		want           []*MenuItem
+	}{
+		{
+			`[{"text": "Reboot", "desc": "Now", "type": "exec", "action": "reboot"}]`, "",
+			[]*MenuItem{{Text: "Reboot", Desc: "Now", Type: "exec", Action: "reboot"}},
+		},
+		{`[]`, "json", []*MenuItem{}},
+		{
+			"# header\nOnly text\r\nText|Desc|exec|echo a|b|key\n\n",
+			"lines",
+			[]*MenuItem{
+				{Text: "Only text", Type: "note"},
+				{Text: "Text", Desc: "Desc", Type: "exec", Action: "echo a", Key: "b|key"},
+			},
+		},
+	} {
+		got, err := ParseItems([]byte(tt.output), tt.format)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseItems(%q, %q) = %v, %v, want %v", tt.output, tt.format, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ output, format string }{
+		{`{"text": "not a list"}`, "json"},
+		{`[{"text": "a"}, null]`, "json"},
+		{`[`, ""},
+		{"a|b", "csv"},
+	} {
+		if _, err := ParseItems([]byte(tt.output), tt.format); err == nil {
+			t.Errorf("ParseItems(%q, %q) didn't fail", tt.output, tt.format)
+		}
+	}
+}
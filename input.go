@@ -0,0 +1,145 @@
+package menuify
+
+import (
+	"strings"
+)
+
+var (
+	inputChars    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,+=@#%&()[]~"
+	inputCommands = []string{"Space", "Delete", "Cancel", "Done"}
+)
+
+// TextInput is a view for entering text with three keys, cycling through a palette of characters and commands
+type TextInput struct {
+	Prompt string
+	Value  string
+
+	palette []string
+	cursor  int
+}
+
+// Input starts a flow with a text input with menuID "INTERNAL_INPUT", calling done with the entered text unless it's cancelled
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) Input(title, prompt, value string, done func(me *MenuEngine, value string)) {
+	ti := &TextInput{
+		Prompt: prompt,
+		Value:  value,
+	}
+	for _, c := range inputChars {
+		ti.palette = append(ti.palette, string(c))
+	}
+	ti.palette = append(ti.palette, inputCommands...)
+	if value != "" {
+		ti.cursor = len(ti.palette) - 1 //start on Done, so existing text can be kept with one press
+	}
+	me.StartFlow("", done)
+	me.ShowView("INPUT", title, ti)
+}
+
+func (ti *TextInput) Render(me *MenuEngine, frame *MenuFrame) {
+	width, _ := me.ViewSize(frame)
+
+	//Lay the palette out as a strip around the cursor
+	before, after := make([]string, 0), make([]string, 0)
+	used := len(ti.palette[ti.cursor]) + 2
+	for i := 1; i < len(ti.palette) && used < width; i++ {
+		prev := ti.palette[(ti.cursor-i+len(ti.palette))%len(ti.palette)]
+		next := ti.palette[(ti.cursor+i)%len(ti.palette)]
+		used += len(prev) + len(next) + 2
+		if used > width {
+			break
+		}
+		before = append([]string{prev}, before...)
+		after = append(after, next)
+	}
+	strip := strings.Join(before, " ") + " [" + ti.palette[ti.cursor] + "] " + strings.Join(after, " ")
+
+	frame.Menu = ti.Prompt + ": " + ti.Value + "_\n\n" + strings.TrimSpace(strip)
+	frame.Footer = " - Select to " + ti.describe()
+}
+
+// describe returns what selecting the highlighted palette entry does
+func (ti *TextInput) describe() string {
+	switch ti.palette[ti.cursor] {
+	case "Space":
+		return "type a space"
+	case "Delete":
+		return "delete the last character"
+	case "Cancel":
+		return "cancel"
+	case "Done":
+		return "confirm"
+	}
+	return "type " + ti.palette[ti.cursor]
+}
+
+func (ti *TextInput) PrevItem(me *MenuEngine) {
+	ti.cursor = (ti.cursor - 1 + len(ti.palette)) % len(ti.palette)
+}
+
+func (ti *TextInput) NextItem(me *MenuEngine) {
+	ti.cursor = (ti.cursor + 1) % len(ti.palette)
+}
+
+func (ti *TextInput) Action(me *MenuEngine) {
+	switch ti.palette[ti.cursor] {
+	case "Space":
+		ti.Value += " "
+	case "Delete":
+		if runes := []rune(ti.Value); len(runes) > 0 {
+			ti.Value = string(runes[:len(runes)-1])
+		}
+	case "Cancel":
+		me.CancelFlow()
+	case "Done":
+		me.ReturnFlow(ti.Value)
+	default:
+		ti.Value += ti.palette[ti.cursor]
+	}
+}
+
+// ConfirmView is a view that asks a yes or no question, defaulting to no
+type ConfirmView struct {
+	Question string
+	Yes, No  string //labels for the choices
+
+	yes bool
+}
+
+// Confirm starts a flow with a confirmation prompt with menuID "INTERNAL_CONFIRM", calling done if the answer is yes
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) Confirm(title, question, yes string, done func(me *MenuEngine)) {
+	me.StartFlow("", func(me *MenuEngine, value string) {
+		done(me)
+	})
+	me.ShowView("CONFIRM", title, &ConfirmView{
+		Question: question,
+		Yes:      yes,
+		No:       "Cancel",
+	})
+}
+
+func (cv *ConfirmView) Render(me *MenuEngine, frame *MenuFrame) {
+	frame.Menu = cv.Question + "\n\n"
+	if cv.yes {
+		frame.Menu += "-> " + cv.Yes + "\n  " + cv.No
+	} else {
+		frame.Menu += "  " + cv.Yes + "\n-> " + cv.No
+	}
+}
+
+func (cv *ConfirmView) PrevItem(me *MenuEngine) {
+	cv.yes = !cv.yes
+}
+
+func (cv *ConfirmView) NextItem(me *MenuEngine) {
+	cv.yes = !cv.yes
+}
+
+func (cv *ConfirmView) Action(me *MenuEngine) {
+	if cv.yes {
+		me.ReturnFlow(cv.Yes)
+	} else {
+		me.CancelFlow()
+	}
+}
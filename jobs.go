@@ -0,0 +1,276 @@
+package menuify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxFinishedJobs is how many finished jobs are kept for the jobs menu, forgetting the oldest past it
+var MaxFinishedJobs = 20
+
+// Job holds a command running in the background on behalf of a menu
+type Job struct {
+	ID      int
+	Command string       //the command line as written in the config
+	Opts    *ExecOptions //the exec options the job was started with
+	Pane    *OutputPane  //collects the output and the result
+	Started time.Time
+	Grace   time.Duration //how long the command has to exit after SIGINT when cancelled
+	Err     error         //set if the values the command handed back couldn't be parsed
+
+	cancel context.CancelFunc
+}
+
+// Running returns true if the job's command hasn't exited yet
+func (j *Job) Running() bool {
+	return !j.Pane.Done()
+}
+
+// Cancel asks the job's command to exit with SIGINT, following up with SIGKILL if it's still running after the grace period
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Status returns a short description of the job's state and how long it has been running for, or ran for
+func (j *Job) Status() string {
+	res := j.Pane.Result()
+	elapsed := j.Pane.Elapsed().Truncate(time.Second)
+	if res == nil {
+		return fmt.Sprintf("running %s", elapsed)
+	}
+	switch {
+	case res.TimedOut:
+		return fmt.Sprintf("timed out after %s", elapsed)
+	case res.Cancelled:
+		return fmt.Sprintf("cancelled after %s", elapsed)
+	case !res.Started():
+		return "failed to start"
+	case res.ExitCode < 0:
+		return fmt.Sprintf("killed after %s", elapsed)
+	}
+	return fmt.Sprintf("exit %d after %s", res.ExitCode, elapsed)
+}
+
+// StartJob starts the given command with exec options as a background job, and returns it
+func (me *MenuEngine) StartJob(command string, opts *ExecOptions) *Job {
+	cmd, err := me.Command(command, opts)
+	if err != nil {
+		me.ErrorText(err.Error(), command)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		Command: command,
+		Opts:    opts,
+		Pane:    NewOutputPane(opts),
+		Started: time.Now(),
+		Grace:   cmd.Grace,
+		cancel:  cancel,
+	}
+	job.Pane.job = job
+	job.Pane.Progress = cmd.Progress
+	cmd.Stdout = job.Pane
+	cmd.Stderr = job.Pane
+
+	me.jobsMu.Lock()
+	me.nextJob++
+	job.ID = me.nextJob
+	me.Jobs = append(me.Jobs, job)
+	me.jobsMu.Unlock()
+	me.countJobs()
+
+	go func() {
+		res := me.runCommand(ctx, cmd, true)
+		cancel()
+		me.Do(func() {
+			job.Err = me.ApplyResult(res, opts)
+			job.Pane.Finish(res)
+			me.jobDone(job)
+		})
+	}()
+	go job.Pane.Tick(me)
+	return job
+}
+
+// GetJob returns the job with the given ID, or nil if there isn't one
+func (me *MenuEngine) GetJob(id int) *Job {
+	me.jobsMu.Lock()
+	defer me.jobsMu.Unlock()
+	for _, job := range me.Jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// jobDone notes a finished job, following its routing unless its pane is on screen to be left first
+func (me *MenuEngine) jobDone(job *Job) {
+	me.pruneJobs()
+	me.countJobs()
+	if lm, ok := me.Menus[me.LoadedMenu]; !ok || lm == nil || lm.View != job.Pane {
+		if job.Err != nil {
+			me.Notify(fmt.Sprintf("Job #%d failed to parse output: %v", job.ID, job.Err))
+		} else {
+			me.Notify(fmt.Sprintf("Job #%d %s: %s", job.ID, job.Status(), job.Command))
+		}
+		if job.Pane.takeRoute() && job.Err == nil {
+			me.route(job.Pane.Result(), job.Opts)
+		}
+	}
+	if me.LoadedMenu == "INTERNAL_JOBS" {
+		me.refreshJobs()
+		me.Redraw()
+	}
+	if me.OnJobDone != nil {
+		me.OnJobDone(me, job)
+	}
+}
+
+// pruneJobs forgets the oldest finished jobs once there are more than MaxFinishedJobs of them
+func (me *MenuEngine) pruneJobs() {
+	me.jobsMu.Lock()
+	defer me.jobsMu.Unlock()
+	finished := 0
+	for _, job := range me.Jobs {
+		if !job.Running() {
+			finished++
+		}
+	}
+	kept := me.Jobs[:0]
+	for _, job := range me.Jobs {
+		if !job.Running() && finished > MaxFinishedJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	for i := len(kept); i < len(me.Jobs); i++ {
+		me.Jobs[i] = nil
+	}
+	me.Jobs = kept
+}
+
+// countJobs sets JOBS_RUNNING to the number of jobs still running, for conditions such as enabledIf: "$JOBS_RUNNING == 0"
+func (me *MenuEngine) countJobs() {
+	me.jobsMu.Lock()
+	running := 0
+	for _, job := range me.Jobs {
+		if job.Running() {
+			running++
+		}
+	}
+	me.jobsMu.Unlock()
+	me.SetVar("JOBS_RUNNING", strconv.Itoa(running))
+}
+
+// JobsMenu generates a menu with menuID "INTERNAL_JOBS" listing all running and finished jobs, and navigates to it
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) JobsMenu() {
+	me.init()
+	me.Menus["INTERNAL_JOBS"] = &MenuItemList{Title: "Jobs"}
+	if _, ok := me.Hooks["INTERNAL_JOBS"]; !ok {
+		me.Hook("INTERNAL_JOBS", func(me *MenuEngine) {
+			me.refreshJobs()
+			me.Redraw()
+			me.jobsWatch++ //stops the ticker from the last time the menu was entered
+			watch := me.jobsWatch
+			go Interval(time.Second, func() (err error) {
+				me.Do(func() {
+					if me.LoadedMenu != "INTERNAL_JOBS" || me.jobsWatch != watch {
+						err = fmt.Errorf("left jobs menu")
+						return
+					}
+					me.refreshJobs()
+					me.Redraw()
+				})
+				return err
+			})
+		})
+	}
+	me.refreshJobs()
+	me.ChangeMenu("INTERNAL_JOBS")
+}
+
+// refreshJobs rebuilds the items of the jobs menu in place, so the cursor stays put
+func (me *MenuEngine) refreshJobs() {
+	lm, ok := me.Menus["INTERNAL_JOBS"]
+	if !ok || lm == nil {
+		return
+	}
+
+	me.jobsMu.Lock()
+	items := make([]*MenuItem, 0, len(me.Jobs))
+	for i := len(me.Jobs) - 1; i >= 0; i-- {
+		job := me.Jobs[i]
+		items = append(items, &MenuItem{
+			Text:   fmt.Sprintf("#%d [%s] %s", job.ID, job.Status(), job.Command),
+			Desc:   "View the output or cancel this job",
+			Type:   "internal",
+			Action: fmt.Sprintf("job %d menu", job.ID),
+		})
+	}
+	me.jobsMu.Unlock()
+
+	if len(items) == 0 {
+		items = append(items, &MenuItem{Text: "No jobs have been started", Type: "note"})
+	}
+	lm.Items = items
+	if me.LoadedMenu == "INTERNAL_JOBS" && me.ItemCursor >= len(items) {
+		me.ItemCursor = len(items) - 1
+	}
+}
+
+// JobAction runs an action for a job: menu, output or cancel
+func (me *MenuEngine) JobAction(id, action string) {
+	jobID, err := strconv.Atoi(id)
+	if err != nil {
+		me.ErrorText("Invalid job ID", id)
+		return
+	}
+	job := me.GetJob(jobID)
+	if job == nil {
+		me.ErrorText("Unknown job", id)
+		return
+	}
+
+	switch action {
+	case "menu":
+		me.JobMenu(job)
+	case "output":
+		me.ShowView("OUTPUT", job.Command, job.Pane)
+	case "cancel":
+		if job.Running() {
+			job.Cancel()
+			me.Notify(fmt.Sprintf("Cancelling job #%d", job.ID))
+		}
+		me.PrevMenu()
+	default:
+		me.ErrorText("Unknown job action", action)
+	}
+}
+
+// JobMenu generates a menu with menuID "INTERNAL_JOB" for a job's output and cancellation, and navigates to it
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) JobMenu(job *Job) {
+	menuJob := &MenuItemList{
+		Title:    fmt.Sprintf("Job #%d", job.ID),
+		Subtitle: job.Command,
+		Items: []*MenuItem{
+			{
+				Text:   "View output",
+				Desc:   job.Status(),
+				Type:   "internal",
+				Action: fmt.Sprintf("job %d output", job.ID),
+			},
+		},
+	}
+	if job.Running() {
+		menuJob.AddItem("Cancel", fmt.Sprintf("Sends SIGINT, then SIGKILL after %s", job.Grace), "internal", fmt.Sprintf("job %d cancel", job.ID))
+	}
+	me.Menus["INTERNAL_JOB"] = menuJob
+	me.ChangeMenu("INTERNAL_JOB")
+}
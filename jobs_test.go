@@ -0,0 +1,42 @@
+package menuify
+
+import (
+	"testing"
+	"time"
+)
+
+// TestJobAlongsideInput runs a background job while menus change, for go test -race to check the engine stays locked
+func TestJobAlongsideInput(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{
+		{Text: "Sub", Type: "menu", Action: "sub"},
+		{Text: "Note", Type: "note"},
+	}})
+	me.AddMenu("sub", &MenuItemList{Items: []*MenuItem{{Text: "Note", Type: "note"}}})
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.RunRealtimeWith("echo done", &ExecOptions{Background: true})
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		me.NextItem()
+		me.Do(func() {
+			me.ChangeMenu("sub")
+			me.AddMenu("other", &MenuItemList{})
+			me.PrevMenu()
+		})
+		me.PrevItem()
+		if me.GetJob(1) != nil && !me.GetJob(1).Running() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job didn't finish")
+		}
+	}
+	var running string
+	me.Do(func() { running, _ = me.GetVar("JOBS_RUNNING") })
+	if running != "0" {
+		t.Errorf("JOBS_RUNNING = %q, want 0", running)
+	}
+}
@@ -10,20 +10,26 @@ import (
 	"github.com/JoshuaDoes/json"
 )
 
-var (
-	keyCalibration map[string][]*MenuKeycodeBinding = make(map[string][]*MenuKeycodeBinding)
-)
-
 type MenuKeycodeBinding struct {
 	Keycode   uint16 `json:"keycode"`
 	Action    string `json:"action"`
 	OnRelease bool   `json:"onRelease"`
 }
 
-func (me *MenuEngine) BindKeys() {
-	for keyboard, bindings := range keyCalibration {
+// BindKeys replaces any keycode listeners started by a previous call with new ones for the engine's keybinds, and returns them
+// It locks the engine itself to emit inputDevice events, so it mustn't be called with the engine locked
+func (me *MenuEngine) BindKeys() []*KeycodeListener {
+	for _, kl := range me.keysrv {
+		kl.Close()
+	}
+	me.keysrv = make([]*KeycodeListener, 0)
+
+	for keyboard, bindings := range me.Keybinds {
 		kl, err := NewKeycodeListener(keyboard)
 		if err != nil {
+			me.Do(func() {
+				me.Emit(&Event{Name: EventInputDevice, Data: map[string]string{"device": keyboard, "state": "failed", "error": err.Error()}})
+			})
 			panic(fmt.Sprintf("error listening to keyboard %s: %v", keyboard, err))
 		}
 		for _, binding := range bindings {
@@ -40,15 +46,28 @@ func (me *MenuEngine) BindKeys() {
 			}
 			kl.Bind(binding.Keycode, binding.OnRelease, action)
 		}
-		go kl.Run()
+		me.keysrv = append(me.keysrv, kl)
+		me.Do(func() {
+			me.Emit(&Event{Name: EventInputDevice, Data: map[string]string{"device": keyboard, "state": "added"}})
+		})
+		go func(kl *KeycodeListener) {
+			kl.Run()
+			if !kl.closed {
+				me.Do(func() {
+					me.Emit(&Event{Name: EventInputDevice, Data: map[string]string{"device": kl.Keyboard, "state": "removed"}})
+				})
+			}
+		}(kl)
 	}
+	return me.keysrv
 }
 
 type KeyCalibration struct {
-	Ready  bool
-	Cancel bool
-	Action string
-	KLs    []*KeycodeListener
+	Ready    bool
+	Cancel   bool
+	Action   string
+	KLs      []*KeycodeListener
+	Keybinds map[string][]*MenuKeycodeBinding //results of the current calibration
 }
 
 func (kc *KeyCalibration) Input(keyboard string, keycode uint16, onRelease bool) {
@@ -66,10 +85,10 @@ func (kc *KeyCalibration) Input(keyboard string, keycode uint16, onRelease bool)
 	if onRelease {
 		return
 	}
-	if keyCalibration[keyboard] == nil {
-		keyCalibration[keyboard] = make([]*MenuKeycodeBinding, 0)
+	if kc.Keybinds[keyboard] == nil {
+		kc.Keybinds[keyboard] = make([]*MenuKeycodeBinding, 0)
 	}
-	keyCalibration[keyboard] = append(keyCalibration[keyboard], &MenuKeycodeBinding{
+	kc.Keybinds[keyboard] = append(kc.Keybinds[keyboard], &MenuKeycodeBinding{
 		Keycode:   keycode,
 		Action:    kc.Action,
 		OnRelease: true,
@@ -77,13 +96,51 @@ func (kc *KeyCalibration) Input(keyboard string, keycode uint16, onRelease bool)
 	kc.Action = ""
 }
 
+// Calibrate runs the key calibrator using a standalone calibration file, generating one if it doesn't exist yet
 func (me *MenuEngine) Calibrate(keyCalibrationFile string) error {
 	if keyCalibrationFile == "" {
 		keyCalibrationFile = "./keyCalibration.json"
 	}
 
-	//Generate a key calibration file if one doesn't exist yet
-	calibrator := &KeyCalibration{KLs: make([]*KeycodeListener, 0)}
+	keyCalibrationJSON, err := ioutil.ReadFile(keyCalibrationFile)
+	if err == nil {
+		keybinds := make(map[string][]*MenuKeycodeBinding)
+		if err := json.Unmarshal(keyCalibrationJSON, &keybinds); err == nil {
+			me.Keybinds = keybinds
+		}
+	}
+
+	return me.CalibrateWith(func(keybinds map[string][]*MenuKeycodeBinding) error {
+		keyboards, err := json.Marshal(keybinds, true)
+		if err != nil {
+			return fmt.Errorf("error encoding calibration results: %v", err)
+		}
+		keyboardsFile, err := os.Create(keyCalibrationFile)
+		if err != nil {
+			return fmt.Errorf("error creating calibration file: %v", err)
+		}
+		defer keyboardsFile.Close()
+		_, err = keyboardsFile.Write(keyboards)
+		if err != nil {
+			return fmt.Errorf("error writing calibration file: %v", err)
+		}
+		return nil
+	})
+}
+
+// CalibrateWith runs the key calibrator, offering to recalibrate if the engine already has keybinds
+// The results replace the engine's keybinds and are handed to save, which may be nil
+func (me *MenuEngine) CalibrateWith(save func(keybinds map[string][]*MenuKeycodeBinding) error) error {
+	me.init()
+	calibrator := &KeyCalibration{
+		KLs:      make([]*KeycodeListener, 0),
+		Keybinds: make(map[string][]*MenuKeycodeBinding),
+	}
+	defer func() {
+		for i := 0; i < len(calibrator.KLs); i++ {
+			calibrator.KLs[i].Close()
+		}
+	}()
 
 	//Get a list of keyboards
 	keyboards := make([]string, 0)
@@ -114,15 +171,7 @@ func (me *MenuEngine) Calibrate(keyCalibrationFile string) error {
 	for stage := 0; stage < stages; stage++ {
 		switch stage {
 		case 0:
-			keyCalibrationJSON, err := ioutil.ReadFile(keyCalibrationFile)
-			if err == nil {
-				keyCalibration = make(map[string][]*MenuKeycodeBinding)
-				err = json.Unmarshal(keyCalibrationJSON, &keyCalibration)
-				if err != nil {
-					stage = 1
-					continue
-				}
-
+			if len(me.Keybinds) > 0 {
 				me.Screen.Clear()
 				ScreenPrintln(me.Screen, "Press any key within\n5 seconds to recalibrate.\n")
 				calibrator.Ready = true
@@ -144,7 +193,7 @@ func (me *MenuEngine) Calibrate(keyCalibrationFile string) error {
 			}
 		case 1:
 			calibrator.Ready = false
-			keyCalibration = make(map[string][]*MenuKeycodeBinding)
+			calibrator.Keybinds = make(map[string][]*MenuKeycodeBinding)
 			me.Screen.Clear()
 			ScreenPrintln(me.Screen, "Welcome to the calibrator!\n")
 			ScreenPrintln(me.Screen, "Press any key to cancel.\n")
@@ -186,18 +235,11 @@ func (me *MenuEngine) Calibrate(keyCalibrationFile string) error {
 		case 5:
 			me.Screen.Clear()
 			ScreenPrintln(me.Screen, "Saving results...\n")
-			keyboards, err := json.Marshal(keyCalibration, true)
-			if err != nil {
-				return fmt.Errorf("error encoding calibration results: %v", err)
-			}
-			keyboardsFile, err := os.Create(keyCalibrationFile)
-			if err != nil {
-				return fmt.Errorf("error creating calibration file: %v", err)
-			}
-			defer keyboardsFile.Close()
-			_, err = keyboardsFile.Write(keyboards)
-			if err != nil {
-				return fmt.Errorf("error writing calibration file: %v", err)
+			me.Keybinds = calibrator.Keybinds
+			if save != nil {
+				if err := save(me.Keybinds); err != nil {
+					return err
+				}
 			}
 			//ScreenPrintln(me.Screen, string(keyboards))
 			//ScreenPrintln(me.Screen, "Calibration complete!")
@@ -206,8 +248,5 @@ func (me *MenuEngine) Calibrate(keyCalibrationFile string) error {
 		}
 	}
 
-	for i := 0; i < len(calibrator.KLs); i++ {
-		calibrator.KLs[i].Close()
-	}
 	return nil
 }
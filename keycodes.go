@@ -22,6 +22,7 @@ type KeycodeListener struct {
 
 	running bool
 	closed  bool
+	paused  bool
 }
 
 //Bind binds a keycode to a handler, bind nil to remove all bindings to the keycode
@@ -82,6 +83,9 @@ func (kl *KeycodeListener) Run() {
 		if !kl.running {
 			break //Exit the keylogger if we're done
 		}
+		if kl.paused {
+			continue //Drop events while another program has the input
+		}
 
 		switch e.Type {
 		case keylogger.EvKey:
@@ -107,6 +111,16 @@ func (kl *KeycodeListener) Run() {
 	}
 }
 
+//Pause drops all events until Resume is called
+func (kl *KeycodeListener) Pause() {
+	kl.paused = true
+}
+
+//Resume handles events again after a call to Pause
+func (kl *KeycodeListener) Resume() {
+	kl.paused = false
+}
+
 //Close closes the keycode listener
 func (kl *KeycodeListener) Close() {
 	if kl.closed {
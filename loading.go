@@ -0,0 +1,129 @@
+package menuify
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// menuLoad tracks a command running in the background to fill in a menu
+type menuLoad struct {
+	started time.Time
+	cancel  context.CancelFunc
+	quiet   bool //don't show the loading indicator
+	exec    bool //the menu's exec action, rather than its generator
+
+	progress *Progress //reported by the command, if it reports any
+}
+
+func (ml *menuLoad) status() string {
+	elapsed := time.Since(ml.started)
+	status := fmt.Sprintf("%s Loading... %s", spinner[int(elapsed/(time.Millisecond*250))%len(spinner)], elapsed.Truncate(time.Second))
+	if ml.progress != nil {
+		ml.progress.Lock()
+		if !ml.progress.Indeterminate {
+			status += fmt.Sprintf(" %3.0f%%", ml.progress.Percent)
+		}
+		if ml.progress.Status != "" {
+			status += " - " + ml.progress.Status
+		}
+		ml.progress.Unlock()
+	}
+	return status
+}
+
+// loadMenu starts a menu's exec action in the background, showing a loading indicator in the menu until the output is added to it
+// Leaving the menu cancels the exec action and nothing is added, until coming back to the menu starts it again
+func (me *MenuEngine) loadMenu(menuID string, lm *MenuItemList) {
+	lm.execCancelled = false
+	me.startLoad(menuID, lm, lm.Exec, lm.ExecOpts, false, func(cmd *Command, res *Result) {
+		me.addResult(lm, cmd, res, lm.ExecOpts)
+	})
+	if lm.loading != nil {
+		lm.loading.exec = true
+	}
+}
+
+// startLoad runs a command in the background for a menu, calling done with the result if the menu is still loaded when it finishes
+// Unless quiet is set, the menu shows a loading indicator in the meantime
+func (me *MenuEngine) startLoad(menuID string, lm *MenuItemList, command string, opts *ExecOptions, quiet bool, done func(cmd *Command, res *Result)) {
+	cmd, err := me.Command(command, opts)
+	if err != nil {
+		me.ErrorText(err.Error(), command)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	load := &menuLoad{started: time.Now(), cancel: cancel, quiet: quiet, progress: cmd.Progress}
+	lm.loading = load
+
+	go func() {
+		res := me.runCommand(ctx, cmd, true)
+		cancel()
+		me.Do(func() {
+			if lm.loading == load {
+				lm.loading = nil
+			}
+			if res.Cancelled || me.LoadedMenu != menuID {
+				return //we left the menu
+			}
+			done(cmd, res)
+		})
+	}()
+	if quiet {
+		return
+	}
+	go Interval(time.Millisecond*250, func() (err error) {
+		me.Do(func() {
+			if lm.loading != load || me.LoadedMenu != menuID {
+				err = fmt.Errorf("menu loaded")
+				return
+			}
+			me.Redraw()
+		})
+		return err
+	})
+}
+
+// showProgress shows a command's progress in the loaded menu while the engine waits on it, returning a function to call once it's done
+// Nothing else can use the engine in the meantime, so the menu is redrawn without Do
+func (me *MenuEngine) showProgress(progress *Progress) (stop func()) {
+	lm, ok := me.Menus[me.LoadedMenu]
+	if !ok || lm == nil || lm.loading != nil {
+		return func() {}
+	}
+	lm.loading = &menuLoad{started: time.Now(), cancel: func() {}, progress: progress}
+	me.Redraw()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Millisecond * 250)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				me.Redraw()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		lm.loading = nil
+	}
+}
+
+// cancelLoad cancels the loaded menu's background command if it's still running
+func (me *MenuEngine) cancelLoad() {
+	lm, ok := me.Menus[me.LoadedMenu]
+	if !ok || lm == nil || lm.loading == nil {
+		return
+	}
+	lm.loading.cancel()
+	lm.execCancelled = lm.loading.exec
+	lm.loading = nil
+}
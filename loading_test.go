@@ -0,0 +1,40 @@
+package menuify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRestartsOnReturn(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{})
+	me.AddMenu("slow", &MenuItemList{Exec: `sh -c "sleep 0.2; echo loaded"`})
+	me.AddMenu("sub", &MenuItemList{})
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.ChangeMenu("slow")
+		me.ChangeMenu("sub")
+		me.PrevMenu()
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var texts []string
+		me.Do(func() {
+			for _, item := range me.Menus["slow"].Items {
+				texts = append(texts, item.Text)
+			}
+		})
+		if len(texts) > 0 {
+			if len(texts) != 1 || strings.TrimSpace(texts[0]) != "loaded" {
+				t.Errorf("loaded %q", texts)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the exec action never finished")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
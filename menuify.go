@@ -8,10 +8,14 @@ import (
 )
 
 type Menu struct {
-	Config *MenuConfig
-	Engine *MenuEngine
-	Screen *MenuScreen
-	Keysrv []*KeycodeListener
+	Config     *MenuConfig
+	ConfigPath string
+	Engine     *MenuEngine
+	Screen     *MenuScreen
+	Keysrv     []*KeycodeListener
+
+	eventSubs []int    //subscriptions for the config's event handlers, replaced when reloading
+	computed  []string //names of the config's computed vars, replaced when reloading
 }
 
 func NewMenu() *Menu {
@@ -36,9 +40,14 @@ func (m *Menu) Load(configPath string) error {
 	if err := json.Unmarshal(configJSON, cfg); err != nil {
 		return err
 	}
+	//The engine changes its menus as it runs, so Config is decoded separately to keep it as loaded for Save
+	loaded := &MenuConfig{}
+	json.Unmarshal(configJSON, loaded)
+	m.Config = loaded
+	m.ConfigPath = configPath
 
 	for key, val := range cfg.Environment {
-		m.Engine.Environment[key] = val
+		m.Engine.SetVar(key, val)
 	}
 
 	m.Engine.ClearMenus()
@@ -46,9 +55,82 @@ func (m *Menu) Load(configPath string) error {
 		m.Engine.AddMenu(id, itemList)
 	}
 	m.Engine.HomeMenu = cfg.HomeMenu
+	m.Engine.ExecDefaults = cfg.Exec
+	m.Engine.EnvFallback = cfg.EnvFallback
+	m.Engine.Places = cfg.Explorer
+
+	for _, id := range m.eventSubs {
+		m.Engine.Unsubscribe(id)
+	}
+	m.eventSubs = make([]int, 0)
+	for name, handlers := range cfg.Events {
+		for _, handler := range handlers {
+			m.eventSubs = append(m.eventSubs, m.Engine.SubscribeExec(name, handler))
+		}
+	}
+
+	for _, name := range m.computed {
+		m.Engine.UnsetComputed(name)
+	}
+	m.computed = make([]string, 0)
+	for name, cv := range cfg.Computed {
+		m.Engine.SetComputed(name, cv)
+		m.computed = append(m.computed, name)
+	}
+
+	m.Engine.Keybinds = make(map[string][]*MenuKeycodeBinding)
+	for keyboard, bindings := range cfg.Keybinds {
+		m.Engine.Keybinds[keyboard] = bindings
+	}
+	if len(m.Keysrv) > 0 {
+		//Hot reloading the config, so rebind the keys we were already listening to
+		m.BindKeys()
+	}
+
+	return nil
+}
 
-	//TODO: Load keybinds from cfg.Keybinds, apply to m.Keysrv
-	//If necessary, unload all keybinds first in case of hot reloading config
+// Save writes Config back to the path it was loaded from, which is the config as loaded along with any changes made to Config itself
+func (m *Menu) Save() error {
+	if m.Config == nil || m.ConfigPath == "" {
+		return fmt.Errorf("menu: need a loaded config to save")
+	}
 
+	configJSON, err := json.Marshal(m.Config, true)
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	if err := ioutil.WriteFile(m.ConfigPath, configJSON, 0644); err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
 	return nil
 }
+
+// BindKeys replaces any active keycode listeners with ones for the engine's current keybinds
+func (m *Menu) BindKeys() {
+	m.Keysrv = m.Engine.BindKeys()
+}
+
+// Calibrate runs the key calibrator against the keybinds loaded from the config
+// If save is set, the results are merged into the config's keybinds and written back to the config file
+func (m *Menu) Calibrate(save bool) error {
+	if m.Engine == nil {
+		return fmt.Errorf("menu: need engine to calibrate")
+	}
+
+	return m.Engine.CalibrateWith(func(keybinds map[string][]*MenuKeycodeBinding) error {
+		if !save {
+			return nil
+		}
+		if m.Config == nil {
+			return fmt.Errorf("menu: need a loaded config to save calibration results")
+		}
+		if m.Config.Keybinds == nil {
+			m.Config.Keybinds = make(map[string][]*MenuKeycodeBinding)
+		}
+		for keyboard, bindings := range keybinds {
+			m.Config.Keybinds[keyboard] = bindings
+		}
+		return m.Save()
+	})
+}
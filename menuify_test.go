@@ -0,0 +1,48 @@
+package menuify
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveRoundTrip(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"home": "home",
+		"environment": {"NAME": "value"},
+		"keybinds": {"/dev/input/event0": [{"keycode": 103, "action": "prev"}]},
+		"menus": {"home": {"title": "Home", "items": [{"text": "Note", "type": "note"}]}}
+	}`), 0644)
+
+	m := NewMenu()
+	if err := m.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if binds := m.Engine.Keybinds["/dev/input/event0"]; len(binds) != 1 || binds[0].Keycode != 103 || binds[0].Action != "prev" {
+		t.Fatalf("keybinds %v", m.Engine.Keybinds)
+	}
+
+	//What the engine does to its menus at runtime stays out of the saved config
+	m.Engine.Menus["home"].AddItem("exec output", "Task complete", "note", "")
+	m.Config.Keybinds["/dev/input/event1"] = []*MenuKeycodeBinding{{Keycode: 28, Action: "action"}}
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := ioutil.ReadFile(configPath)
+	for _, unwanted := range []string{"exec output", "visibleIf", "execOpts", "null", "explorer"} {
+		if strings.Contains(string(saved), unwanted) {
+			t.Errorf("saved config has %q:\n%s", unwanted, saved)
+		}
+	}
+
+	reloaded := NewMenu()
+	if err := reloaded.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Engine.Keybinds) != 2 || len(reloaded.Engine.Menus["home"].Items) != 1 || reloaded.Engine.Environment["NAME"] != "value" {
+		t.Errorf("reloaded keybinds %v and items %v", reloaded.Engine.Keybinds, reloaded.Engine.Menus["home"].Items)
+	}
+}
@@ -0,0 +1,335 @@
+package menuify
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// MaxPaneLines is how many lines of output an output pane keeps, dropping the oldest past it
+	MaxPaneLines = 5000
+
+	ansiEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+	spinner    = []string{"|", "/", "-", "\\"}
+)
+
+// OutputPane is a view that collects a command's output as it arrives, showing a live tail that can be scrolled back through
+type OutputPane struct {
+	sync.Mutex
+	Opts     *ExecOptions //decides where to go when leaving the pane after the command finishes
+	Progress *Progress    //drawn as a bar above the output if set
+
+	lines    []string
+	partial  strings.Builder
+	dropped  int  //lines dropped from the start to stay within MaxPaneLines
+	escape   int  //how far into an escape sequence the output is, as they can be split across writes
+	cr       bool //a carriage return is waiting to see if a newline follows it
+	routed   bool //the options' routing was followed already, so it only happens once
+	started  time.Time
+	finished time.Time
+	result   *Result
+	scroll   int  //first line shown when not following
+	follow   bool //keep the last line in view
+	height   int  //height of the last render, for scrolling by pages
+	total    int  //wrapped line count of the last render
+	job      *Job //the job writing to this pane, if any
+	task     bool //the pane shows a Go task rather than a command
+}
+
+// NewOutputPane returns an output pane ready to be written to
+func NewOutputPane(opts *ExecOptions) *OutputPane {
+	op := &OutputPane{
+		Opts:    opts,
+		lines:   make([]string, 0),
+		started: time.Now(),
+		follow:  true,
+	}
+	if opts != nil && opts.Progress != "" {
+		op.Progress = &Progress{}
+	}
+	return op
+}
+
+// Write adds output to the pane, treating a carriage return as a rewrite of the current line
+// Escape sequences are left out, and once there are more than MaxPaneLines lines the oldest are dropped
+func (op *OutputPane) Write(p []byte) (int, error) {
+	op.Lock()
+	defer op.Unlock()
+
+	for _, c := range p {
+		switch {
+		case op.escape == 1 && c == '[':
+			op.escape = 2
+			continue
+		case op.escape == 1:
+			op.escape = 0 //a two byte escape, such as ESC 7
+			continue
+		case op.escape == 2 && c >= 0x20:
+			if c >= '@' && c <= '~' {
+				op.escape = 0
+			}
+			continue
+		}
+		op.escape = 0
+
+		if op.cr && c != '\n' {
+			op.partial.Reset()
+		}
+		op.cr = false
+		switch c {
+		case 0x1b:
+			op.escape = 1
+		case '\n':
+			op.lines = append(op.lines, op.partial.String())
+			op.partial.Reset()
+		case '\r':
+			op.cr = true
+		default:
+			op.partial.WriteByte(c)
+		}
+	}
+	if len(op.lines) > MaxPaneLines {
+		op.dropped += len(op.lines) - MaxPaneLines
+		op.lines = op.lines[len(op.lines)-MaxPaneLines:]
+	}
+	return len(p), nil
+}
+
+// Finish marks the command as finished with a result
+func (op *OutputPane) Finish(res *Result) {
+	op.Lock()
+	defer op.Unlock()
+	op.finished = time.Now()
+	op.result = res
+}
+
+// Done returns true if the command has finished
+func (op *OutputPane) Done() bool {
+	op.Lock()
+	defer op.Unlock()
+	return op.result != nil
+}
+
+// Result returns the result of the command, or nil if it's still running
+func (op *OutputPane) Result() *Result {
+	op.Lock()
+	defer op.Unlock()
+	return op.result
+}
+
+// Elapsed returns how long the command has been running for, or ran for
+func (op *OutputPane) Elapsed() time.Duration {
+	op.Lock()
+	defer op.Unlock()
+	if op.result == nil {
+		return time.Since(op.started)
+	}
+	return op.finished.Sub(op.started)
+}
+
+// Log returns all of the output written so far
+func (op *OutputPane) Log() string {
+	op.Lock()
+	defer op.Unlock()
+	log := strings.Join(op.lines, "\n")
+	if op.partial.Len() > 0 {
+		log += "\n" + op.partial.String()
+	}
+	return log
+}
+
+// Status returns a line describing the state of the command
+func (op *OutputPane) Status() string {
+	op.Lock()
+	defer op.Unlock()
+	return op.status()
+}
+
+func (op *OutputPane) status() string {
+	if op.result == nil {
+		elapsed := time.Since(op.started)
+		return fmt.Sprintf("%s Running for %s", spinner[int(elapsed/(time.Millisecond*250))%len(spinner)], elapsed.Truncate(time.Second))
+	}
+	elapsed := op.finished.Sub(op.started).Truncate(time.Second)
+	if op.task {
+		if op.result.Err != nil {
+			return fmt.Sprintf("Failed after %s: %v", elapsed, op.result.Err)
+		}
+		return fmt.Sprintf("Finished after %s", elapsed)
+	}
+	if !op.result.Started() {
+		return fmt.Sprintf("Failed to start: %v", op.result.Err)
+	}
+	if op.result.TimedOut {
+		return fmt.Sprintf("Timed out after %s", elapsed)
+	}
+	if op.result.Cancelled {
+		return fmt.Sprintf("Cancelled after %s", elapsed)
+	}
+	if op.result.ExitCode < 0 {
+		return fmt.Sprintf("Killed (%v) after %s", op.result.Err, elapsed)
+	}
+	return fmt.Sprintf("Exit status %d after %s", op.result.ExitCode, elapsed)
+}
+
+func (op *OutputPane) Render(me *MenuEngine, frame *MenuFrame) {
+	op.Lock()
+	defer op.Unlock()
+
+	width, height := me.ViewSize(frame)
+	progress := ""
+	if op.Progress != nil {
+		progress = op.Progress.status() + "\n\n" + op.Progress.Bar(width) + "\n\n"
+		height -= 4
+		if height < 1 {
+			height = 1
+		}
+	}
+	op.height = height
+	lines := op.lines
+	if op.partial.Len() > 0 {
+		lines = append(lines[:len(lines):len(lines)], op.partial.String())
+	}
+	lines = wrapLines(lines, width)
+	op.total = len(lines)
+
+	bottom := len(lines) - height
+	if bottom < 0 {
+		bottom = 0
+	}
+	if op.follow || op.scroll > bottom {
+		op.scroll = bottom
+	}
+	end := op.scroll + height
+	if end > len(lines) {
+		end = len(lines)
+	}
+	frame.Menu = progress + strings.Join(lines[op.scroll:end], "\n")
+
+	frame.Footer = " - " + op.status()
+	if op.result != nil && op.result.Truncated {
+		frame.Footer += " (output truncated)"
+	}
+	if op.dropped > 0 {
+		frame.Footer += fmt.Sprintf(" (%d earlier lines dropped)", op.dropped)
+	}
+	if len(lines) > height {
+		frame.Footer += fmt.Sprintf(" [%d-%d/%d]", op.scroll+1, end, len(lines))
+	}
+	if op.result != nil {
+		frame.Footer += "\n - Select to continue"
+	} else if !op.follow {
+		frame.Footer += "\n - Select to follow the output"
+	} else if op.job != nil {
+		frame.Footer += "\n - Select to hide or cancel"
+	}
+}
+
+// PrevItem scrolls up by half a page
+func (op *OutputPane) PrevItem(me *MenuEngine) {
+	op.Lock()
+	defer op.Unlock()
+	op.follow = false
+	op.scroll -= op.page()
+	if op.scroll < 0 {
+		op.scroll = 0
+	}
+}
+
+// NextItem scrolls down by half a page, following the output again once the end is reached
+func (op *OutputPane) NextItem(me *MenuEngine) {
+	op.Lock()
+	defer op.Unlock()
+	op.scroll += op.page()
+	if op.scroll+op.height >= op.total {
+		op.follow = true
+	}
+}
+
+func (op *OutputPane) page() int {
+	if op.height < 2 {
+		return 1
+	}
+	return op.height / 2
+}
+
+// Action follows the output while the command runs, or opens its job's menu if the output is already followed
+// Once the command has finished, it leaves the pane
+func (op *OutputPane) Action(me *MenuEngine) {
+	op.Lock()
+	res := op.result
+	following := op.follow
+	op.follow = true
+	op.Unlock()
+	if res == nil {
+		if following && op.job != nil {
+			me.JobMenu(op.job)
+		}
+		return
+	}
+
+	me.PrevMenu()
+	if !op.takeRoute() {
+		return //the routing was followed when the job finished in the background
+	}
+	if op.job != nil && op.job.Err != nil {
+		me.ErrorText("Failed to parse output", op.job.Err.Error())
+		return
+	}
+	if me.route(res, op.Opts) {
+		return
+	}
+	if res.TimedOut {
+		me.ErrorText(op.Status(), tailLines(op.Log(), 10))
+	}
+}
+
+// takeRoute returns true the first time it's called, so that the options' routing is only followed once
+func (op *OutputPane) takeRoute() bool {
+	op.Lock()
+	defer op.Unlock()
+	if op.routed {
+		return false
+	}
+	op.routed = true
+	return true
+}
+
+// Tick redraws the engine while the pane is on screen, until the command finishes
+func (op *OutputPane) Tick(me *MenuEngine) {
+	Interval(time.Millisecond*250, func() error {
+		done := op.Done()
+		me.Do(func() {
+			if lm, ok := me.Menus[me.LoadedMenu]; ok && lm != nil && lm.View == op {
+				me.Redraw()
+			}
+		})
+		if done {
+			return fmt.Errorf("pane finished")
+		}
+		return nil
+	})
+}
+
+// RunTask runs a Go function in the background, showing its progress and anything it logs in an output pane
+// The task runs on its own goroutine, so it needs Do to use the engine
+func (me *MenuEngine) RunTask(title string, task func(progress *Progress, log io.Writer) error) *OutputPane {
+	op := NewOutputPane(nil)
+	op.Progress = &Progress{}
+	op.task = true
+	go func() {
+		err := task(op.Progress, op)
+		res := &Result{Err: err}
+		if err != nil {
+			res.ExitCode = 1
+		}
+		op.Finish(res)
+	}()
+	go op.Tick(me)
+	me.ShowView("TASK", title, op)
+	return op
+}
@@ -0,0 +1,153 @@
+package menuify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaneWrite(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"plain", []string{"a\nb"}, "a\nb"},
+		{"split escape", []string{"red \x1b[3", "1mtext\x1b", "[0m\n"}, "red text"},
+		{"two byte escape", []string{"a\x1b7b\n"}, "ab"},
+		{"carriage return rewrites", []string{"10%\r", "20%\rdone\n"}, "done"},
+		{"crlf keeps the line", []string{"one\r", "\ntwo\r\n"}, "one\ntwo"},
+	} {
+		op := NewOutputPane(nil)
+		for _, w := range tt.writes {
+			op.Write([]byte(w))
+		}
+		if got := op.Log(); got != tt.want {
+			t.Errorf("%s: Log() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPaneDropsOldLines(t *testing.T) {
+	defer func(max int) { MaxPaneLines = max }(MaxPaneLines)
+	MaxPaneLines = 3
+	op := NewOutputPane(nil)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(op, "%d\n", i)
+	}
+	if got := op.Log(); got != "3\n4\n5" || op.dropped != 2 {
+		t.Errorf("Log() = %q with %d dropped, want 3 lines and 2 dropped", got, op.dropped)
+	}
+}
+
+// TestJobRoutesOnce follows a background job's routing when it finishes, and not again when its pane is left
+func TestJobRoutesOnce(t *testing.T) {
+	me := NewMenuEngine()
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{{Text: "Note", Type: "note"}}})
+	me.AddMenu("done", &MenuItemList{Items: []*MenuItem{{Text: "Note", Type: "note"}}})
+	var job *Job
+	me.Do(func() {
+		me.ChangeMenu("home")
+		job = me.StartJob("true", &ExecOptions{Background: true, OnSuccess: "done"})
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("job didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	me.Do(func() {
+		if me.LoadedMenu != "done" {
+			t.Errorf("LoadedMenu = %q after the job finished, want done", me.LoadedMenu)
+		}
+		me.ChangeMenu("home")
+		me.ShowView("OUTPUT", job.Command, job.Pane)
+		job.Pane.Action(me)
+		if me.LoadedMenu != "home" {
+			t.Errorf("LoadedMenu = %q after leaving the pane, want home", me.LoadedMenu)
+		}
+	})
+}
+
+func TestFinishedJobsPruned(t *testing.T) {
+	defer func(max int) { MaxFinishedJobs = max }(MaxFinishedJobs)
+	MaxFinishedJobs = 2
+	me := NewMenuEngine()
+	var jobs []*Job
+	me.Do(func() {
+		for i := 0; i < 4; i++ {
+			jobs = append(jobs, me.StartJob("true", &ExecOptions{Background: true}))
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for _, job := range jobs {
+		for job.Running() {
+			if time.Now().After(deadline) {
+				t.Fatal("jobs didn't finish")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	me.Do(func() {
+		if len(me.Jobs) != 2 {
+			var ids []string
+			for _, job := range me.Jobs {
+				ids = append(ids, fmt.Sprint(job.ID))
+			}
+			t.Errorf("kept jobs %s, want 2 of them", strings.Join(ids, ", "))
+		}
+	})
+}
+
+// TestPaneStreamsAndScrolls shows the tail of a command's output while following it, and pages back through it with the navigation keys
+func TestPaneStreamsAndScrolls(t *testing.T) {
+	me := NewMenuEngine()
+	me.LinesH, me.LinesV = 40, 14 //a pane 6 lines high
+	me.AddMenu("home", &MenuItemList{})
+	var pane *OutputPane
+	me.Do(func() {
+		me.ChangeMenu("home")
+		pane = me.RunRealtimeWith("seq 1 20", nil)
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for !pane.Done() {
+		if time.Now().After(deadline) {
+			t.Fatal("command didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	render := func() *MenuFrame {
+		var frame *MenuFrame
+		me.Do(func() { frame = me.GetRender() })
+		return frame
+	}
+	frame := render()
+	if frame.Menu != "15\n16\n17\n18\n19\n20" || !strings.Contains(frame.Footer, "Exit status 0") || !strings.Contains(frame.Footer, "[15-20/20]") {
+		t.Fatalf("drew %q with footer %q", frame.Menu, frame.Footer)
+	}
+	me.PrevItem()
+	if frame := render(); !strings.HasPrefix(frame.Menu, "12\n") {
+		t.Errorf("scrolled up to %q", frame.Menu)
+	}
+	for i := 0; i < 10; i++ {
+		me.PrevItem()
+	}
+	if frame := render(); !strings.HasPrefix(frame.Menu, "1\n") {
+		t.Errorf("scrolled to the top at %q", frame.Menu)
+	}
+	for i := 0; i < 10; i++ {
+		me.NextItem()
+	}
+	if frame := render(); !strings.HasSuffix(frame.Menu, "\n20") {
+		t.Errorf("scrolled to the bottom at %q", frame.Menu)
+	}
+
+	me.Action()
+	if me.LoadedMenu != "home" {
+		t.Errorf("selecting the finished pane went to %q", me.LoadedMenu)
+	}
+}
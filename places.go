@@ -0,0 +1,273 @@
+package menuify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoshuaDoes/json"
+)
+
+var (
+	// RecentSaveDelay is how long a visit waits before the recent file is written, so browsing around writes it once instead of on every directory
+	RecentSaveDelay = time.Second * 30
+
+	// PseudoFilesystems lists filesystem types left off the explorer's mount points, as there's nothing to browse on them
+	PseudoFilesystems = []string{
+		"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs", "devpts", "devtmpfs", "efivarfs",
+		"fusectl", "hugetlbfs", "mqueue", "nsfs", "proc", "pstore", "rpc_pipefs", "securityfs", "selinuxfs", "sysfs", "tracefs",
+	}
+)
+
+// ExplorerConfig holds the places listed on the explorer's root page
+type ExplorerConfig struct {
+	Bookmarks  []*Bookmark `json:"bookmarks,omitempty"`
+	RecentFile string      `json:"recentFile,omitempty"` //where recently visited directories are kept, or empty to forget them on exit
+	MaxRecent  int         `json:"maxRecent,omitempty"`  //how many recently visited directories to list, defaults to 5
+	MountTable string      `json:"mountTable,omitempty"` //where mount points are read from, defaults to /proc/self/mounts
+}
+
+// Bookmark is a named location listed on the explorer's root page
+type Bookmark struct {
+	Name     string `json:"name,omitempty"`
+	Location string `json:"location,omitempty"`
+}
+
+// Mount is a mounted filesystem from a mount table
+type Mount struct {
+	Device string
+	Dir    string
+	FSType string
+	Free   uint64 //bytes available, once ReadSpace has filled it in
+	Total  uint64 //bytes in total, once ReadSpace has filled it in
+}
+
+// ReadSpace fills in the free and total space of the mounted filesystem, which can block for as long as the filesystem doesn't respond
+func (m *Mount) ReadSpace() error {
+	free, total, err := freeSpace(m.Dir)
+	if err != nil {
+		return err
+	}
+	m.Free, m.Total = free, total
+	return nil
+}
+
+// describe returns a mount's filesystem, device and space, if known
+func (m *Mount) describe() string {
+	desc := m.FSType + " on " + m.Device
+	if m.Total > 0 {
+		desc += fmt.Sprintf(", %s free of %s", FormatSize(int64(m.Free)), FormatSize(int64(m.Total)))
+	}
+	return desc
+}
+
+// ExplorerRoot generates the explorer's root page with menuID "INTERNAL_EXPLORER_ROOT" and navigates to it
+// It lists bookmarks, recently visited directories and mount points, each opening an explorer with the given options
+func (me *MenuEngine) ExplorerRoot(bin string, opts *ExplorerOptions) {
+	me.enterExplorer()
+	cfg := me.explorerConfig()
+	root := &MenuItemList{
+		Title: "Explorer - Places",
+		Items: make([]*MenuItem, 0),
+	}
+	place := func(text, desc, location string) {
+		root.Items = append(root.Items, &MenuItem{Text: escapeVars(text), Desc: escapeVars(desc), Type: "explorer " + escapeVars(location), Action: bin, ExplorerOpts: opts})
+	}
+
+	for _, bookmark := range cfg.Bookmarks {
+		name := bookmark.Name
+		if name == "" {
+			name = bookmark.Location
+		}
+		place(name, "Bookmark - "+bookmark.Location, bookmark.Location)
+	}
+	for _, location := range me.RecentDirs() {
+		place(location, "Recently visited", location)
+	}
+
+	//The mount table describes the OS filesystem, so it means nothing once another filesystem has replaced it
+	var mounts []*Mount
+	var err error
+	if _, replaced := me.Filesystems[""]; !replaced {
+		mounts, err = ReadMounts(cfg.MountTable)
+	}
+	if err != nil || len(mounts) == 0 {
+		place("/", "The root of the filesystem", "/")
+	}
+	for _, mount := range mounts {
+		place(mount.Dir, mount.describe(), mount.Dir)
+		me.readSpace(root, root.Items[len(root.Items)-1], mount)
+	}
+
+	me.AddMenu("INTERNAL_EXPLORER_ROOT", root)
+	me.ChangeMenu("INTERNAL_EXPLORER_ROOT")
+}
+
+// readSpace fills in a mount's free space on its item in the background, as a dead network or FUSE mount can hang statfs
+// A mount still hanging from an earlier visit isn't asked again
+func (me *MenuEngine) readSpace(root *MenuItemList, item *MenuItem, mount *Mount) {
+	if me.spacePending[mount.Dir] {
+		item.Desc += ", not responding"
+		return
+	}
+	if me.spacePending == nil {
+		me.spacePending = make(map[string]bool)
+	}
+	me.spacePending[mount.Dir] = true
+
+	go func() {
+		err := mount.ReadSpace()
+		me.Do(func() {
+			delete(me.spacePending, mount.Dir)
+			if err != nil || mount.Total == 0 {
+				return
+			}
+			item.Desc = escapeVars(mount.describe())
+			if me.Menus[me.LoadedMenu] == root {
+				me.Redraw()
+			}
+		})
+	}()
+}
+
+// explorerConfig returns the explorer config with its defaults filled in
+func (me *MenuEngine) explorerConfig() *ExplorerConfig {
+	cfg := ExplorerConfig{}
+	if me.Places != nil {
+		cfg = *me.Places
+	}
+	if cfg.MaxRecent == 0 {
+		cfg.MaxRecent = 5
+	}
+	if cfg.MountTable == "" {
+		cfg.MountTable = "/proc/self/mounts"
+	}
+	return &cfg
+}
+
+// ReadMounts reads the mount points from a mount table in the format of /proc/self/mounts, skipping pseudo filesystems
+// It doesn't touch the filesystems themselves, so their space is left for ReadSpace
+func ReadMounts(mountTable string) ([]*Mount, error) {
+	data, err := ioutil.ReadFile(mountTable)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := make([]*Mount, 0)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || isPseudoFS(fields[2]) {
+			continue
+		}
+		dir := unescapeMount(fields[1])
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		mounts = append(mounts, &Mount{Device: unescapeMount(fields[0]), Dir: dir, FSType: fields[2]})
+	}
+	return mounts, nil
+}
+
+func isPseudoFS(fsType string) bool {
+	for _, pseudo := range PseudoFilesystems {
+		if fsType == pseudo {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMount decodes the octal escapes a mount table uses for spaces and other special characters
+func unescapeMount(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+	unescaped := &strings.Builder{}
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(field[i])
+	}
+	return unescaped.String()
+}
+
+// RecentDirs returns the recently visited directories, most recent first
+func (me *MenuEngine) RecentDirs() []string {
+	me.loadRecent()
+	return append([]string{}, me.recent...)
+}
+
+// visit remembers a directory as recently visited, replacing any of its parents so only the deepest visit is kept
+func (me *MenuEngine) visit(location string) {
+	me.loadRecent()
+	cfg := me.explorerConfig()
+	location = strings.TrimSuffix(location, "/")
+	if location == "" || strings.HasPrefix(location, "INTERNAL") {
+		return
+	}
+
+	recent := []string{location}
+	for _, dir := range me.recent {
+		if dir == location || strings.HasPrefix(location, strings.TrimSuffix(dir, "/")+"/") {
+			continue
+		}
+		recent = append(recent, dir)
+	}
+	if len(recent) > cfg.MaxRecent {
+		recent = recent[:cfg.MaxRecent]
+	}
+	me.recent = recent
+
+	if cfg.RecentFile != "" && !me.recentPending {
+		me.recentPending = true
+		time.AfterFunc(RecentSaveDelay, func() { me.Do(me.SaveRecent) })
+	}
+}
+
+// SaveRecent writes the recently visited directories to the recent file if they changed since it was last read or written
+// Visits save them after RecentSaveDelay, so call it before exiting to keep the latest ones
+func (me *MenuEngine) SaveRecent() {
+	me.recentPending = false
+	cfg := me.explorerConfig()
+	if cfg.RecentFile == "" || me.recent == nil {
+		return
+	}
+	recentJSON, err := json.Marshal(me.recent, true)
+	if err != nil || string(recentJSON) == me.recentSaved {
+		return
+	}
+	os.MkdirAll(path.Dir(cfg.RecentFile), 0755)
+	if err := ioutil.WriteFile(cfg.RecentFile, recentJSON, 0644); err == nil {
+		me.recentSaved = string(recentJSON)
+	}
+}
+
+// loadRecent reads the recently visited directories from the recent file the first time they're needed
+func (me *MenuEngine) loadRecent() {
+	if me.recent != nil {
+		return
+	}
+	me.recent = make([]string, 0)
+	cfg := me.explorerConfig()
+	if cfg.RecentFile == "" {
+		return
+	}
+	if recentJSON, err := ioutil.ReadFile(cfg.RecentFile); err == nil {
+		json.Unmarshal(recentJSON, &me.recent)
+	}
+	if saved, err := json.Marshal(me.recent, true); err == nil {
+		me.recentSaved = string(saved)
+	}
+}
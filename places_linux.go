@@ -0,0 +1,14 @@
+package menuify
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users and the total size of the filesystem holding dir
+func freeSpace(dir string) (uint64, uint64, error) {
+	stat := &syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package menuify
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeSpace isn't supported here yet, so mount points are listed without their space
+func freeSpace(dir string) (uint64, uint64, error) {
+	return 0, 0, fmt.Errorf("free space isn't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,64 @@
+package menuify
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReadMounts(t *testing.T) {
+	table := filepath.Join(t.TempDir(), "mounts")
+	ioutil.WriteFile(table, []byte("/dev/sda1 / ext4 rw 0 0\n"+
+		"proc /proc proc rw 0 0\n"+
+		"/dev/sdb1 /media/my\\040disk vfat rw 0 0\n"+
+		"/dev/sda1 / ext4 rw 0 0\n"), 0644)
+
+	mounts, err := ReadMounts(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 {
+		t.Fatalf("read %d mounts", len(mounts))
+	}
+	if m := mounts[1]; m.Dir != "/media/my disk" || m.Device != "/dev/sdb1" || m.FSType != "vfat" || m.Total != 0 {
+		t.Errorf("read %+v", m)
+	}
+}
+
+func TestVisitSavesLater(t *testing.T) {
+	defer func(delay time.Duration) { RecentSaveDelay = delay }(RecentSaveDelay)
+	RecentSaveDelay = time.Hour
+
+	recentFile := filepath.Join(t.TempDir(), "recent.json")
+	me := NewMenuEngine()
+	me.Places = &ExplorerConfig{RecentFile: recentFile, MaxRecent: 2}
+	me.visit("/a")
+	me.visit("/a/b")
+	me.visit("/c")
+	if _, err := ioutil.ReadFile(recentFile); err == nil {
+		t.Fatal("recent file written before the delay")
+	}
+
+	me.SaveRecent()
+	me.recent = nil
+	if dirs := me.RecentDirs(); len(dirs) != 2 || dirs[0] != "/c" || dirs[1] != "/a/b" {
+		t.Errorf("recent dirs %q", dirs)
+	}
+}
+
+func TestRootSkipsMountsOfReplacedFS(t *testing.T) {
+	table := filepath.Join(t.TempDir(), "mounts")
+	ioutil.WriteFile(table, []byte("/dev/sdb1 /media/disk vfat rw 0 0\n"), 0644)
+
+	me := NewMenuEngine()
+	me.Places = &ExplorerConfig{MountTable: table, MaxRecent: 2}
+	me.Filesystems = map[string]fs.FS{"": fstest.MapFS{}}
+	me.Do(func() { me.ExplorerRoot("", nil) })
+	items := me.Menus["INTERNAL_EXPLORER_ROOT"].Items
+	if len(items) != 1 || items[0].Text != "/" {
+		t.Errorf("root lists %d places, want just /", len(items))
+	}
+}
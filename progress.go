@@ -0,0 +1,175 @@
+package menuify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress holds the progress reported by a task, drawn as a bar with a status line
+type Progress struct {
+	sync.Mutex
+	Percent       float64 //0 to 100
+	Indeterminate bool    //the task can't tell how far along it is
+	Status        string  //what the task is doing right now
+}
+
+// Set sets the progress as a percentage, leaving indeterminate mode
+func (p *Progress) Set(percent float64) {
+	p.Lock()
+	defer p.Unlock()
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	p.Percent = percent
+	p.Indeterminate = false
+}
+
+// SetIndeterminate switches to indeterminate mode, for tasks that can't tell how far along they are
+func (p *Progress) SetIndeterminate() {
+	p.Lock()
+	defer p.Unlock()
+	p.Indeterminate = true
+}
+
+// SetStatus sets the status line
+func (p *Progress) SetStatus(status string) {
+	p.Lock()
+	defer p.Unlock()
+	p.Status = status
+}
+
+// ParseLine updates the progress from a protocol line, returning false if the line isn't part of the protocol
+// The protocol is PROGRESS <percent>, PROGRESS <done>/<total> or PROGRESS - for indeterminate, and STATUS <text>
+func (p *Progress) ParseLine(line string) bool {
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(line, "STATUS "):
+		p.SetStatus(strings.TrimSpace(line[7:]))
+		return true
+	case strings.HasPrefix(line, "PROGRESS "):
+		value := strings.TrimSuffix(strings.TrimSpace(line[9:]), "%")
+		if value == "-" || value == "?" {
+			p.SetIndeterminate()
+			return true
+		}
+		if slash := strings.IndexByte(value, '/'); slash >= 0 {
+			done, err1 := strconv.ParseFloat(value[:slash], 64)
+			total, err2 := strconv.ParseFloat(value[slash+1:], 64)
+			if err1 != nil || err2 != nil || total <= 0 {
+				return false
+			}
+			p.Set(done / total * 100)
+			return true
+		}
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		p.Set(percent)
+		return true
+	}
+	return false
+}
+
+// Bar returns the progress bar drawn within width, with the percentage after it
+func (p *Progress) Bar(width int) string {
+	p.Lock()
+	defer p.Unlock()
+
+	inner := width - 8 //brackets and percentage
+	if inner < 4 {
+		inner = 4
+	}
+	bar := make([]byte, inner)
+	for i := range bar {
+		bar[i] = '-'
+	}
+
+	if p.Indeterminate {
+		//Bounce a block back and forth
+		block := inner / 5
+		if block < 1 {
+			block = 1
+		}
+		span := inner - block
+		pos := int(time.Now().UnixNano()/int64(time.Millisecond*100)) % (span*2 + 1)
+		if pos > span {
+			pos = span*2 - pos
+		}
+		for i := pos; i < pos+block && i < inner; i++ {
+			bar[i] = '#'
+		}
+		return "[" + string(bar) + "]   ..."
+	}
+
+	filled := int(p.Percent / 100 * float64(inner))
+	for i := 0; i < filled && i < inner; i++ {
+		bar[i] = '#'
+	}
+	return fmt.Sprintf("[%s] %3.0f%%", string(bar), p.Percent)
+}
+
+// status returns the status line
+func (p *Progress) status() string {
+	p.Lock()
+	defer p.Unlock()
+	return p.Status
+}
+
+// maxProtocolLine is how long a line can get before it's passed through without waiting for it to end
+const maxProtocolLine = 4096
+
+// progressWriter picks protocol lines out of a stream to update the progress, passing any other lines through to w
+// A line ends at a newline or a lone carriage return, so progress redrawn in place with \r is picked up as it's written
+type progressWriter struct {
+	progress *Progress
+	w        io.Writer
+	partial  []byte
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.partial = append(pw.partial, p...)
+	for {
+		end := bytes.IndexAny(pw.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+		if pw.partial[end] == '\r' {
+			if end+1 == len(pw.partial) {
+				break //a newline might follow in the next write
+			}
+			if pw.partial[end+1] == '\n' {
+				end++
+			}
+		}
+		pw.line(pw.partial[:end+1])
+		pw.partial = pw.partial[end+1:]
+	}
+	if len(pw.partial) > maxProtocolLine {
+		pw.Flush()
+	}
+	return len(p), nil
+}
+
+// Flush handles whatever was written after the last line ended, for once the stream is closed
+func (pw *progressWriter) Flush() {
+	if len(pw.partial) > 0 {
+		pw.line(pw.partial)
+		pw.partial = nil
+	}
+}
+
+func (pw *progressWriter) line(line []byte) {
+	if !pw.progress.ParseLine(strings.TrimRight(string(line), "\r\n")) && pw.w != nil {
+		pw.w.Write(line)
+	}
+}
@@ -0,0 +1,123 @@
+package menuify
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgressWriter(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		writes  []string
+		percent float64
+		status  string
+		rest    string
+	}{
+		{"lines", []string{"STATUS copying\nPROGRESS 3/4\nother\n"}, 75, "copying", "other\n"},
+		{"split", []string{"PROG", "RESS 4", "0\nST", "ATUS a b\n"}, 40, "a b", ""},
+		{"carriage returns", []string{"PROGRESS 10\rPROGRESS 20\r"}, 20, "", ""},
+		{"crlf", []string{"PROGRESS 30\r", "\nline\r\n"}, 30, "", "line\r\n"},
+		{"unended", []string{"out\nPROGRESS 50"}, 50, "", "out\n"},
+		{"unended output", []string{"PROGRESS 60\nlast"}, 60, "", "last"},
+	} {
+		progress := &Progress{}
+		rest := &strings.Builder{}
+		pw := &progressWriter{progress: progress, w: rest}
+		for _, w := range tt.writes {
+			pw.Write([]byte(w))
+		}
+		pw.Flush()
+		if progress.Percent != tt.percent || progress.Status != tt.status || rest.String() != tt.rest {
+			t.Errorf("%s: got %v%% %q with %q passed through, want %v%% %q with %q", tt.name, progress.Percent, progress.Status, rest.String(), tt.percent, tt.status, tt.rest)
+		}
+	}
+}
+
+func TestProgressLeftOutOfStdout(t *testing.T) {
+	me := NewMenuEngine()
+	opts := &ExecOptions{Progress: "stdout", Parse: "env"}
+	cmd, err := me.Command(`printf 'PROGRESS 50\nKEY=value\nPROGRESS 100'`, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := cmd.Run()
+	if string(res.Stdout) != "KEY=value\n" || cmd.Progress.Percent != 100 {
+		t.Fatalf("Stdout = %q at %v%%", res.Stdout, cmd.Progress.Percent)
+	}
+	if err := me.ApplyResult(res, opts); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := me.GetVar("KEY"); value != "value" {
+		t.Errorf("KEY = %q", value)
+	}
+}
+
+func TestProgressFromFD(t *testing.T) {
+	me := NewMenuEngine()
+	cmd, err := me.Command(`sh -c 'echo STATUS working >&$MENUIFY_PROGRESS_FD; echo out'`, &ExecOptions{Progress: "fd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := cmd.Run()
+	if string(res.Stdout) != "out\n" || cmd.Progress.Status != "working" {
+		t.Errorf("Stdout = %q with status %q", res.Stdout, cmd.Progress.Status)
+	}
+}
+
+// TestRunWithProgress shows the progress in the loaded menu while RunWith waits, and takes it away afterwards
+func TestRunWithProgress(t *testing.T) {
+	me := NewMenuEngine()
+	screen := &recordScreen{}
+	me.Screen = screen
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{{Text: "Note", Type: "note"}}})
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.RunWith(`sh -c 'echo PROGRESS 40; echo STATUS halfway; sleep 0.6; echo done'`, &ExecOptions{Progress: "stdout"})
+	})
+	lm := me.Menus["home"]
+	if lm.loading != nil {
+		t.Error("loading indicator left behind")
+	}
+	if last := lm.Items[len(lm.Items)-1]; last.Text != "done\n" {
+		t.Errorf("output note = %q, want only the output", last.Text)
+	}
+	if !screen.drew("40% - halfway") {
+		t.Error("the progress was never drawn")
+	}
+}
+
+// recordScreen keeps every frame rendered to it
+type recordScreen struct {
+	sync.Mutex
+	frames []*MenuFrame
+}
+
+func (rs *recordScreen) Render(frame *MenuFrame) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.frames = append(rs.frames, frame)
+}
+func (rs *recordScreen) GetFrame() *MenuFrame {
+	rs.Lock()
+	defer rs.Unlock()
+	if len(rs.frames) == 0 {
+		return nil
+	}
+	return rs.frames[len(rs.frames)-1]
+}
+func (rs *recordScreen) Clear()         {}
+func (rs *recordScreen) GetWidth() int  { return 80 }
+func (rs *recordScreen) GetHeight() int { return 24 }
+
+// drew returns true if any frame's menu contained text
+func (rs *recordScreen) drew(text string) bool {
+	rs.Lock()
+	defer rs.Unlock()
+	for _, frame := range rs.frames {
+		if strings.Contains(frame.Menu, text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package menuify
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openPTY fails where pseudo-terminals aren't supported yet, which RunTerminal reports like any other error
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("pseudo-terminals aren't supported on %s", runtime.GOOS)
+}
+
+// setPTYSize fails where pseudo-terminals aren't supported yet
+func setPTYSize(pty *os.File, rows, cols int) error {
+	return fmt.Errorf("pseudo-terminals aren't supported on %s", runtime.GOOS)
+}
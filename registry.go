@@ -0,0 +1,94 @@
+package menuify
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// builtinTypes are the item types Action handles itself, which custom item types can't take over
+	builtinTypes = []string{"internal", "menu", "exec", "explorer", "view", "checksum", "return", "cancel", "setvar", "refresh", "note", "go", "divider"}
+)
+
+// ItemType defines the behavior of a custom item type, for applications to add their own with RegisterItemType
+type ItemType struct {
+	Activate func(me *MenuEngine, item *MenuItem, args []string, action string) //args holds the item's type split into words with vars, starting with its name, and action the item's action with vars
+	Text     func(me *MenuEngine, item *MenuItem) string                        //replaces the item's text when rendering, if set
+	Value    func(me *MenuEngine, item *MenuItem) string                        //drawn inline after the text as "Text: value", if set
+	Suffix   func(me *MenuEngine, item *MenuItem) string                        //drawn after the text and value, like " ..." for menus, if set
+}
+
+// GoAction is a named action written in Go, callable from the config as an item with type "go" and an action of its name followed by any arguments
+type GoAction func(me *MenuEngine, args []string) error
+
+// RegisterItemType registers a custom item type by the first word of an item's type, returning an error for a built-in type
+func (me *MenuEngine) RegisterItemType(name string, itemType *ItemType) error {
+	for _, builtin := range builtinTypes {
+		if name == builtin {
+			return fmt.Errorf("can't replace built-in item type %q", name)
+		}
+	}
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid item type name %q", name)
+	}
+	if me.itemTypes == nil {
+		me.itemTypes = make(map[string]*ItemType)
+	}
+	me.itemTypes[name] = itemType
+	return nil
+}
+
+// RegisterAction registers a named Go action for items with type "go"
+func (me *MenuEngine) RegisterAction(name string, action GoAction) {
+	if me.actions == nil {
+		me.actions = make(map[string]GoAction)
+	}
+	me.actions[name] = action
+}
+
+// GoAction runs a named Go action with arguments, reporting an error through ErrorText
+func (me *MenuEngine) GoAction(name string, args []string) {
+	action, ok := me.actions[name]
+	if !ok {
+		me.ErrorText("Unknown Go action", name)
+		return
+	}
+	if err := action(me, args); err != nil {
+		me.ErrorText("Action "+name+" failed", err.Error())
+	}
+}
+
+// itemType returns the custom item type registered for an item if any, along with the item's type split into words with vars
+func (me *MenuEngine) itemType(item *MenuItem) (*ItemType, []string) {
+	if len(me.itemTypes) == 0 {
+		return nil, nil
+	}
+	args, err := SplitWords(item.Type, me.Vars)
+	if err != nil || len(args) == 0 {
+		return nil, nil
+	}
+	return me.itemTypes[args[0]], args
+}
+
+// itemText returns an item's text as it's rendered, with any inline value and suffix
+func (me *MenuEngine) itemText(item *MenuItem) string {
+	text := item.Text
+	itemType, _ := me.itemType(item)
+	if itemType == nil {
+		if item.Type == "menu" {
+			text += " ..."
+		}
+		return text
+	}
+
+	if itemType.Text != nil {
+		text = itemType.Text(me, item)
+	}
+	if itemType.Value != nil {
+		text += ": " + itemType.Value(me, item)
+	}
+	if itemType.Suffix != nil {
+		text += itemType.Suffix(me, item)
+	}
+	return text
+}
@@ -0,0 +1,58 @@
+package menuify
+
+import "testing"
+
+func TestRegisterItemType(t *testing.T) {
+	me := NewMenuEngine()
+	activated := ""
+	toggle := &ItemType{Activate: func(me *MenuEngine, item *MenuItem, args []string, action string) { activated = args[0] }}
+
+	for _, name := range []string{"menu", "exec", "note", "divider", "", "two words"} {
+		if err := me.RegisterItemType(name, toggle); err == nil {
+			t.Errorf("registered %q", name)
+		}
+	}
+	if err := me.RegisterItemType("toggle", toggle); err != nil {
+		t.Fatal(err)
+	}
+
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{{Text: "Menu", Type: "menu", Action: "other"}, {Text: "Toggle", Type: "toggle on"}}})
+	me.AddMenu("other", &MenuItemList{})
+	me.ChangeMenu("home")
+	me.ItemCursor = 1
+	me.Action()
+	if activated != "toggle" {
+		t.Errorf("activated %q", activated)
+	}
+	me.ItemCursor = 0
+	me.Action()
+	if me.LoadedMenu != "other" {
+		t.Errorf("the menu type went to %q", me.LoadedMenu)
+	}
+}
+
+func TestTypeAndGoArgsWithVars(t *testing.T) {
+	me := NewMenuEngine()
+	var activated, goArgs []string
+	me.RegisterItemType("toggle", &ItemType{Activate: func(me *MenuEngine, item *MenuItem, args []string, action string) { activated = args }})
+	me.RegisterAction("greet", func(me *MenuEngine, args []string) error {
+		goArgs = args
+		return nil
+	})
+	me.SetVar("KIND", "toggle")
+	me.SetVar("WHO", "the world")
+	me.AddMenu("home", &MenuItemList{Items: []*MenuItem{
+		{Text: "Toggle", Type: "$KIND 'on off'"},
+		{Text: "Greet", Type: "go", Action: "greet $WHO 'and $WHO'"},
+	}})
+	me.ChangeMenu("home")
+	me.Action()
+	if len(activated) != 2 || activated[0] != "toggle" || activated[1] != "on off" {
+		t.Errorf("activated with %q", activated)
+	}
+	me.ItemCursor = 1
+	me.Action()
+	if len(goArgs) != 2 || goArgs[0] != "the world" || goArgs[1] != "and $WHO" {
+		t.Errorf("go action got %q", goArgs)
+	}
+}
@@ -1,42 +1,589 @@
 package menuify
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-func Run(prog string, args ...string) ([]byte, error) {
-	cmd := strings.Split(prog, " ")
-	if len(cmd) > 0 {
-		args = append(cmd[1:], args...)
+const (
+	DefaultGrace = time.Second * 5 //how long a cancelled command has to exit after SIGINT before it gets SIGKILL
+)
+
+// ExecOptions holds optional settings for an exec action
+type ExecOptions struct {
+	Shell     bool   `json:"shell,omitempty"`     //run the line with sh -c instead of splitting it into words, vars are then available to the shell as environment variables
+	OnSuccess string `json:"onSuccess,omitempty"` //menu to change to when the command exits zero
+	OnFailure string `json:"onFailure,omitempty"` //menu to change to when the command fails to start or exits non-zero
+
+	Interactive bool   `json:"interactive,omitempty"` //suspend the screen and input, and hand the terminal to the command until it exits
+	Background  bool   `json:"background,omitempty"`  //run the command as a background job instead of taking over the screen
+	PTY         bool   `json:"pty,omitempty"`         //run the command in a pseudo-terminal drawn inside the menu, for interactive commands on screens without a terminal
+	Grace       string `json:"grace,omitempty"`       //how long a cancelled command has to exit after SIGINT before it gets SIGKILL, i.e. 10s
+
+	//Limits, any left unset are filled in from the engine's ExecDefaults
+	Timeout   string `json:"timeout,omitempty"`   //cancel the command if it runs for longer than this, i.e. 30s
+	MaxOutput int    `json:"maxOutput,omitempty"` //maximum bytes of output to keep from each stream, 0 for no limit
+	Dir       string `json:"dir,omitempty"`       //working directory for the command, vars are substituted
+	KillGroup bool   `json:"killGroup,omitempty"` //run the command in its own process group and signal the whole group when cancelling it
+
+	//Output contract, values the command hands back to the menu
+	Parse   string `json:"parse,omitempty"`   //env for KEY=VALUE lines or json for an object, parsed into the environment after the command exits zero or hands back anything
+	ParseFD bool   `json:"parseFD,omitempty"` //parse what the command writes to file descriptor 3, found in $MENUIFY_RESULT_FD, instead of its stdout
+
+	//Progress reporting with PROGRESS <percent> and STATUS <text> lines, drawn as a progress bar
+	Progress string `json:"progress,omitempty"` //stdout to pick the lines out of stdout, or fd to read them from file descriptor 4, found in $MENUIFY_PROGRESS_FD
+
+	files []string //what an explorer passes to its bin in place of $?
+}
+
+// withDefaults returns a copy of the options with any unset limits filled in from defaults
+func (opts *ExecOptions) withDefaults(defaults *ExecOptions) *ExecOptions {
+	merged := &ExecOptions{}
+	if opts != nil {
+		*merged = *opts
+	}
+	if defaults == nil {
+		return merged
+	}
+	if merged.Grace == "" {
+		merged.Grace = defaults.Grace
+	}
+	if merged.Timeout == "" {
+		merged.Timeout = defaults.Timeout
 	}
+	if merged.MaxOutput == 0 {
+		merged.MaxOutput = defaults.MaxOutput
+	}
+	if merged.Dir == "" {
+		merged.Dir = defaults.Dir
+	}
+	merged.KillGroup = merged.KillGroup || defaults.KillGroup
+	return merged
+}
 
-	execCmd := exec.Command(cmd[0], args...)
-	ret, err := execCmd.CombinedOutput()
-	if len(ret) > 0 || (err != nil && err.Error() == "signal: aborted") {
-		err = nil //Hack to get around programs that exit non-zero or abort, we always want the output
+// withFiles returns a copy of the options that substitutes files for $? in the command line, as explorers do with their bin
+func (opts *ExecOptions) withFiles(files []string) *ExecOptions {
+	withFiles := &ExecOptions{}
+	if opts != nil {
+		*withFiles = *opts
 	}
-	//log("RUN: %s %v\n%s", cmd[0], cmdArgs, string(ret))
-	//log("RUN: %s %v", cmd[0], cmdArgs)
-	return ret, err
+	withFiles.files = files
+	return withFiles
 }
 
-func RunRealtime(prog string, args ...string) error {
-	cmd := strings.Split(prog, " ")
-	if len(cmd) > 0 {
-		args = append(cmd[1:], args...)
+// progress returns where progress is reported, if anywhere
+func (opts *ExecOptions) progress() string {
+	if opts == nil {
+		return ""
+	}
+	return opts.Progress
+}
+
+// timeout returns the parsed timeout, or 0 for none
+func (opts *ExecOptions) timeout() time.Duration {
+	if opts == nil || opts.Timeout == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(opts.Timeout)
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// grace returns the parsed grace period, or DefaultGrace
+func (opts *ExecOptions) grace() time.Duration {
+	if opts == nil || opts.Grace == "" {
+		return DefaultGrace
+	}
+	grace, err := time.ParseDuration(opts.Grace)
+	if err != nil || grace < 0 {
+		return DefaultGrace
+	}
+	return grace
+}
+
+// Command holds a program and its arguments, ready to be run on behalf of a menu
+type Command struct {
+	Args   []string  //the program followed by its arguments
+	Env    []string  //KEY=VALUE pairs added to the inherited process environment
+	Stdout io.Writer //optionally receives stdout as it arrives, in addition to it being captured
+	Stderr io.Writer //optionally receives stderr as it arrives, in addition to it being captured
+
+	Terminal       bool          //attach the command directly to our stdin, stdout and stderr, nothing is captured
+	Grace          time.Duration //how long a cancelled command has to exit after SIGINT before it gets SIGKILL, DefaultGrace if 0
+	Timeout        time.Duration //cancel the command if it runs for longer than this, 0 for no limit
+	MaxOutput      int           //maximum bytes of output to keep from each stream, 0 for no limit
+	Dir            string        //working directory, empty for our own
+	KillGroup      bool          //run the command in its own process group and signal the whole group
+	ResultFD       bool          //capture file descriptor 3 of the command into the result, its number is exported as MENUIFY_RESULT_FD
+	Progress       *Progress     //optionally updated from PROGRESS and STATUS lines written to file descriptor 4, its number is exported as MENUIFY_PROGRESS_FD
+	ProgressStdout bool          //pick the progress lines out of stdout instead, leaving them out of the captured output
+	TTY            *os.File      //the slave side of a pseudo-terminal to run the command in as its controlling terminal, closed once the command starts
+}
+
+// Result holds the outcome of a finished command
+type Result struct {
+	ExitCode int //-1 if the command never started or was killed by a signal
+	Stdout   []byte
+	Stderr   []byte
+	Output   []byte //stdout and stderr interleaved in the order they arrived
+	Err      error  //set if the command failed to start or exited non-zero
+
+	Cancelled bool //the command was cancelled before it exited
+	TimedOut  bool //the command was cancelled because it ran past its timeout
+	Truncated bool //output past the limit was thrown away
+
+	Returned []byte //written by the command to MENUIFY_RESULT_FD
+}
+
+// Success returns true if the command ran and exited zero
+func (r *Result) Success() bool {
+	return r.Err == nil && r.ExitCode == 0
+}
+
+// Started returns true if the command ran, regardless of how it exited
+func (r *Result) Started() bool {
+	if r.Err == nil {
+		return true
+	}
+	_, exited := r.Err.(*exec.ExitError)
+	return exited
+}
+
+// NewCommand splits a command line into words like a POSIX shell would, calling expand on any unquoted or double-quoted text
+// If shell is set, the line is instead passed as-is to sh -c
+func NewCommand(line string, shell bool, expand func(string) string) (*Command, error) {
+	if shell {
+		return &Command{Args: []string{"sh", "-c", line}}, nil
+	}
+
+	args, err := SplitWords(line, expand)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("exec: empty command line")
+	}
+	return &Command{Args: args}, nil
+}
+
+func (c *Command) cmd() *exec.Cmd {
+	execCmd := exec.Command(c.Args[0], c.Args[1:]...)
+	execCmd.Dir = c.Dir
+	env := c.Env
+	if c.ResultFD {
+		env = append(env[:len(env):len(env)], "MENUIFY_RESULT_FD=3")
+	}
+	if c.Progress != nil && !c.ProgressStdout {
+		env = append(env[:len(env):len(env)], "MENUIFY_PROGRESS_FD=4")
+	}
+	if len(env) > 0 {
+		execCmd.Env = append(os.Environ(), env...)
+	}
+	return execCmd
+}
+
+// sidePipe hands the command a pipe on file descriptor fd, copying whatever it writes there to w
+// The returned function closes our copy of the write end once the command has started, and wait blocks until the command's copy is closed
+// Once wait is called, anything the command left behind holding the pipe open gets the delay to close it before we stop reading
+func sidePipe(execCmd *exec.Cmd, fd int, w io.Writer, delay time.Duration) (started func(), wait func(), err error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(execCmd.ExtraFiles) <= fd-3 {
+		execCmd.ExtraFiles = append(execCmd.ExtraFiles, nil)
+	}
+	execCmd.ExtraFiles[fd-3] = pw
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(w, r)
+		r.Close()
+		close(done)
+	}()
+	wait = func() {
+		select {
+		case <-done:
+		case <-time.After(delay):
+			r.Close()
+			<-done
+		}
+	}
+	return func() { pw.Close() }, wait, nil
+}
+
+// Run runs the command to completion, capturing its output
+func (c *Command) Run() *Result {
+	return c.RunContext(context.Background())
+}
+
+// RunContext runs the command to completion, capturing its output
+// If the context is done first, the command is sent SIGINT, and then SIGKILL if it's still running after the grace period
+func (c *Command) RunContext(ctx context.Context) *Result {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	output := &syncBuffer{}
+	res := &Result{ExitCode: -1}
+
+	execCmd := c.cmd()
+	progress := &progressWriter{progress: c.Progress}
+	if c.Terminal {
+		execCmd.Stdin = os.Stdin
+		execCmd.Stdout = os.Stdout
+		execCmd.Stderr = os.Stderr
+	} else if c.TTY != nil {
+		execCmd.Stdin = c.TTY
+		execCmd.Stdout = c.TTY
+		execCmd.Stderr = c.TTY
+	} else {
+		//Each stream gets its own limit, as they're copied on goroutines of their own
+		stdoutLimit, stderrLimit := c.limit(teeWriter(stdout, c.Stdout)), c.limit(teeWriter(stderr, c.Stderr))
+		execCmd.Stdout, execCmd.Stderr = stdoutLimit, stderrLimit
+		defer func() {
+			res.Truncated = res.Truncated || stdoutLimit.truncated || stderrLimit.truncated
+		}()
+		if c.MaxOutput > 0 {
+			//Both streams share the combined output, so it gets twice the room
+			output.max = c.MaxOutput * 2
+		}
+		execCmd.Stdout = teeWriter(execCmd.Stdout, output)
+		execCmd.Stderr = teeWriter(execCmd.Stderr, output)
+		if c.Progress != nil && c.ProgressStdout {
+			progress.w = execCmd.Stdout
+			execCmd.Stdout = progress
+		}
+	}
+	c.setProcAttr(execCmd)
+
+	grace := c.Grace
+	if grace <= 0 {
+		grace = DefaultGrace
 	}
+	//Don't wait forever on output pipes held open by something the command left running
+	execCmd.WaitDelay = grace
 
-	execCmd := exec.Command(cmd[0], args...)
-	execCmd.Stdout = os.Stdout
-	execCmd.Stderr = os.Stderr
-	err := execCmd.Run()
-	if err != nil && err.Error() == "signal: aborted" {
-		err = nil
+	sides := make([]func(), 0)
+	waits := make([]func(), 0)
+	returned := &bytes.Buffer{}
+	if c.ResultFD {
+		started, wait, err := sidePipe(execCmd, 3, returned, grace)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		sides = append(sides, started)
+		waits = append(waits, wait)
+	}
+	if c.Progress != nil && !c.ProgressStdout {
+		started, wait, err := sidePipe(execCmd, 4, progress, grace)
+		if err != nil {
+			for _, started := range sides {
+				started()
+			}
+			for _, wait := range waits {
+				wait()
+			}
+			res.Err = err
+			return res
+		}
+		sides = append(sides, started)
+		waits = append(waits, wait)
+	}
+
+	err := execCmd.Start()
+	for _, started := range sides {
+		started()
+	}
+	if c.TTY != nil {
+		c.TTY.Close() //the command has its own copy now
+	}
+	if err != nil {
+		for _, wait := range waits {
+			wait()
+		}
+		res.Err = err
+		return res
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		c.signal(execCmd, syscall.SIGINT)
+		select {
+		case <-done:
+		case <-time.After(grace):
+			c.signal(execCmd, syscall.SIGKILL)
+		}
+	}()
+	res.Err = execCmd.Wait()
+	if errors.Is(res.Err, exec.ErrWaitDelay) && execCmd.ProcessState != nil && execCmd.ProcessState.Success() {
+		res.Err = nil //the command itself succeeded, only something it left running kept its output open
+	}
+	close(done)
+	for _, wait := range waits {
+		wait()
+	}
+	if c.Progress != nil {
+		progress.Flush() //the last line might not have ended
+	}
+	res.Returned = returned.Bytes()
+	res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	res.Cancelled = ctx.Err() != nil && !res.TimedOut
+	res.Truncated = res.Truncated || output.truncated
+
+	if execCmd.ProcessState != nil {
+		res.ExitCode = execCmd.ProcessState.ExitCode()
+	}
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+	res.Output = output.Bytes()
+	return res
+}
+
+// killsGroup returns true if the command runs in its own process group to be signalled as a whole
+// That's the case with KillGroup, and with a timeout so that nothing the command started outlives it
+// Commands handed the terminal stay in the foreground group to keep terminal input
+func (c *Command) killsGroup() bool {
+	return (c.KillGroup || c.Timeout > 0) && !c.Terminal
+}
+
+// limit wraps a writer so it throws away anything past MaxOutput, if set
+func (c *Command) limit(w io.Writer) *limitWriter {
+	remaining := c.MaxOutput
+	if remaining <= 0 {
+		remaining = -1
+	}
+	return &limitWriter{w: w, remaining: remaining}
+}
+
+// limitWriter passes through writes until it runs out of room, and then claims to keep writing so the command doesn't get a broken pipe
+type limitWriter struct {
+	w         io.Writer
+	remaining int  //bytes left to pass through, or -1 for no limit
+	truncated bool //read once the command is done
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.remaining < 0 {
+		return lw.w.Write(p)
+	}
+	if len(p) > lw.remaining {
+		lw.truncated = true
+		if lw.remaining > 0 {
+			lw.w.Write(p[:lw.remaining])
+			lw.remaining = 0
+		}
+		return len(p), nil
+	}
+	lw.remaining -= len(p)
+	return lw.w.Write(p)
+}
+
+// syncBuffer is a buffer that can be written to by stdout and stderr at the same time
+type syncBuffer struct {
+	sync.Mutex
+	buf       bytes.Buffer
+	max       int //stop keeping output after this many bytes, 0 for no limit
+	truncated bool
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	n := len(p)
+	if sb.max > 0 && sb.buf.Len()+n > sb.max {
+		sb.truncated = true
+		p = p[:sb.max-sb.buf.Len()]
 	}
-	return err
+	sb.buf.Write(p)
+	return n, nil
+}
+
+func (sb *syncBuffer) Bytes() []byte {
+	sb.Lock()
+	defer sb.Unlock()
+	return sb.buf.Bytes()
+}
+
+func teeWriter(writers ...io.Writer) io.Writer {
+	tee := make([]io.Writer, 0, len(writers))
+	for _, w := range writers {
+		if w != nil {
+			tee = append(tee, w)
+		}
+	}
+	return io.MultiWriter(tee...)
+}
+
+// String returns the command line with every argument quoted for a shell
+func (c *Command) String() string {
+	quoted := make([]string, len(c.Args))
+	for i := 0; i < len(c.Args); i++ {
+		quoted[i] = ShellQuote(c.Args[i])
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SplitWords splits a line into words, honouring single quotes, double quotes and backslash escapes
+// Text outside of single quotes and escapes is passed through expand if it isn't nil, and the result always stays within its word
+// The one exception is an unquoted word of just $@NAME, which expands $NAME as a list with one word per line
+func SplitWords(line string, expand func(string) string) ([]string, error) {
+	words := make([]string, 0)
+	word := ""
+	inWord := false
+	quoted := false //part of the word was quoted or escaped
+	pending := ""   //text waiting to be expanded
+	flush := func() {
+		if expand != nil {
+			word += expand(pending)
+		} else {
+			word += pending
+		}
+		pending = ""
+	}
+	finish := func() {
+		if expand != nil && !quoted && word == "" && listVar.MatchString(pending) {
+			list := expand("$" + pending[2:])
+			if list == "$"+pending[2:] {
+				list = "" //unset, so there's nothing to list
+			}
+			for _, item := range strings.Split(list, "\n") {
+				if item != "" {
+					words = append(words, item)
+				}
+			}
+		} else {
+			flush()
+			words = append(words, word)
+		}
+		word = ""
+		pending = ""
+		inWord = false
+		quoted = false
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case ' ', '\t', '\n':
+			if inWord {
+				finish()
+			}
+		case '\\':
+			if i+1 >= len(line) {
+				return nil, fmt.Errorf("exec: trailing backslash in %q", line)
+			}
+			i++
+			inWord = true
+			quoted = true
+			if line[i] == '\n' {
+				continue //line continuation
+			}
+			flush()
+			word += string(line[i])
+		case '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("exec: unterminated single quote in %q", line)
+			}
+			flush()
+			word += line[i+1 : i+1+end]
+			i += end + 1
+			inWord = true
+			quoted = true
+		case '"':
+			flush() //a var name ends at the quote
+			inWord = true
+			quoted = true
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\\\"$`\n", line[i+1]) >= 0 {
+					flush()
+					if line[i+1] != '\n' {
+						word += string(line[i+1])
+					}
+					i++
+					continue
+				}
+				pending += string(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("exec: unterminated double quote in %q", line)
+			}
+			flush()
+		case '$':
+			//Keep ${...} in one piece, as its default can hold spaces
+			if end := closingBrace(line, i+2); i+1 < len(line) && line[i+1] == '{' && end >= 0 {
+				pending += line[i : end+1]
+				i = end
+			} else {
+				pending += string(c)
+			}
+			inWord = true
+		default:
+			pending += string(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		finish()
+	}
+	return words, nil
+}
+
+// ShellQuote returns s quoted so that a shell or SplitWords reads it back as a single word
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./-_", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func Run(prog string, args ...string) ([]byte, error) {
+	cmd, err := NewCommand(prog, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Args = append(cmd.Args, args...)
+
+	res := cmd.Run()
+	return res.Output, res.Err
+}
+
+func RunRealtime(prog string, args ...string) error {
+	cmd, err := NewCommand(prog, false, nil)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append(cmd.Args, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run().Err
 }
 
 func Interval(dur time.Duration, call func() error) {
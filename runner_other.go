@@ -0,0 +1,21 @@
+//go:build !unix
+
+package menuify
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr leaves the command as it is, as process groups and sessions are only set up on unix
+func (c *Command) setProcAttr(execCmd *exec.Cmd) {}
+
+// signal kills the command for SIGKILL and passes anything else on, which not every system supports
+// Only the command itself is signalled, as it has no process group of its own here
+func (c *Command) signal(execCmd *exec.Cmd, sig syscall.Signal) {
+	if sig == syscall.SIGKILL {
+		execCmd.Process.Kill()
+		return
+	}
+	execCmd.Process.Signal(sig)
+}
@@ -0,0 +1,90 @@
+package menuify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitWords(t *testing.T) {
+	vars := map[string]string{"A": "one two", "EMPTY": "", "LIST": "x y\nz\n"}
+	expand := func(in string) string {
+		me := &MenuEngine{Environment: vars}
+		return me.Vars(in)
+	}
+	for _, tt := range []struct {
+		line string
+		want []string
+	}{
+		{`echo a  b`, []string{"echo", "a", "b"}},
+		{`echo $A`, []string{"echo", "one two"}},
+		{`echo "$A"x`, []string{"echo", "one twox"}},
+		{`echo '$A'`, []string{"echo", "$A"}},
+		{`echo \$A`, []string{"echo", "$A"}},
+		{`echo "a\"b"`, []string{"echo", `a"b`}},
+		{`echo $EMPTY ''`, []string{"echo", "", ""}},
+		{`echo ${NOPE:-two words}`, []string{"echo", "two words"}},
+		{`echo $@LIST $@NOPE end`, []string{"echo", "x y", "z", "end"}},
+		{`echo "$@LIST"`, []string{"echo", "$@LIST"}},
+		{"echo a\\\nb", []string{"echo", "ab"}},
+	} {
+		got, err := SplitWords(tt.line, expand)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitWords(%q) = %q, %v, want %q", tt.line, got, err, tt.want)
+		}
+	}
+	for _, line := range []string{`echo "a`, `echo 'a`, `echo a\`} {
+		if _, err := SplitWords(line, expand); err == nil {
+			t.Errorf("SplitWords(%q) didn't fail", line)
+		}
+	}
+}
+
+func TestRunTimeoutWithGrandchild(t *testing.T) {
+	cmd := &Command{
+		Args:    []string{"sh", "-c", "sleep 6; echo hi"},
+		Timeout: 500 * time.Millisecond,
+		Grace:   200 * time.Millisecond,
+	}
+	start := time.Now()
+	res := cmd.Run()
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+	if !res.TimedOut {
+		t.Errorf("TimedOut = false, want true")
+	}
+}
+
+func TestRunGrandchildHoldsResultFD(t *testing.T) {
+	cmd := &Command{
+		Args:     []string{"sh", "-c", "echo KEY=value >&3; echo out; sleep 6 &"},
+		ResultFD: true,
+		Grace:    200 * time.Millisecond,
+	}
+	start := time.Now()
+	res := cmd.Run()
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+	if string(res.Returned) != "KEY=value\n" || string(res.Stdout) != "out\n" {
+		t.Errorf("Returned = %q, Stdout = %q", res.Returned, res.Stdout)
+	}
+	if res.Err != nil || !res.Success() || !res.Started() {
+		t.Errorf("Err = %v, Success = %v, want a successful run", res.Err, res.Success())
+	}
+}
+
+func TestRunTruncatesBothStreams(t *testing.T) {
+	cmd := &Command{
+		Args:      []string{"sh", "-c", "seq 1 2000; seq 1 2000 >&2"},
+		MaxOutput: 100,
+	}
+	res := cmd.Run()
+	if !res.Truncated || len(res.Stdout) != 100 || len(res.Stderr) != 100 {
+		t.Errorf("Truncated = %v with %d and %d bytes kept", res.Truncated, len(res.Stdout), len(res.Stderr))
+	}
+	if !res.Success() {
+		t.Errorf("Err = %v", res.Err)
+	}
+}
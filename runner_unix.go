@@ -0,0 +1,27 @@
+//go:build unix
+
+package menuify
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr puts the command in a session of its own for a pseudo-terminal, or in its own process group to be signalled as a whole
+func (c *Command) setProcAttr(execCmd *exec.Cmd) {
+	if c.TTY != nil {
+		//A new session is also a new process group, so signalling the group still works
+		execCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	} else if c.killsGroup() {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+}
+
+// signal sends a signal to the command, or to its whole process group if it has one
+func (c *Command) signal(execCmd *exec.Cmd, sig syscall.Signal) {
+	if c.killsGroup() {
+		syscall.Kill(-execCmd.Process.Pid, sig)
+		return
+	}
+	execCmd.Process.Signal(sig)
+}
@@ -16,6 +16,12 @@ type MenuScreen interface {
 	GetHeight() int
 }
 
+//MenuSuspender is an optional capability for screens that can hand the terminal over to another program and take it back
+type MenuSuspender interface {
+	Suspend() //Restores the terminal to how it was before the screen took it over
+	Resume()  //Takes the terminal back, the engine redraws right after
+}
+
 func ScreenPrintf(ms MenuScreen, format string, args ...interface{}) {
 	for {
 		if len(format) == 0 {
@@ -23,6 +23,8 @@ type MenuScreen_Ncurses struct {
 	//Padding for centered rendering, total for the count rather than one side
 	paddingW int //i.e. use 6 if you want 3 lines of padding on both sides
 	paddingH int
+
+	suspended bool //the terminal is handed to another program
 }
 
 func NewMenuScreenNcurses(m *menuify.Menu) *MenuScreen_Ncurses {
@@ -52,12 +54,11 @@ func NewMenuScreenNcurses(m *menuify.Menu) *MenuScreen_Ncurses {
 
 	go menuify.Interval(time.Nanosecond * 16666, func() error {
 		if term := leased; term != nil {
-			height, width := ms.Terminal.GetMaxYX()
-			if height != ms.Menu.Engine.LinesV || width != ms.Menu.Engine.LinesH {
-				ms.Menu.Engine.LinesV = height
-				ms.Menu.Engine.LinesH = width
-				ms.Menu.Engine.Redraw()
+			if ms.suspended {
+				return nil
 			}
+			height, width := ms.Terminal.GetMaxYX()
+			ms.Menu.Engine.Resize(width, height)
 			return nil
 		}
 		timing = false
@@ -122,6 +123,25 @@ func (ms *MenuScreen_Ncurses) GetHeight() int {
 	return height
 }
 
+//Suspend ends curses mode so another program can use the terminal
+func (ms *MenuScreen_Ncurses) Suspend() {
+	if ms.suspended {
+		return
+	}
+	ms.suspended = true
+	ncurses.EndWin()
+}
+
+//Resume returns to curses mode, the next refresh restores the terminal settings from before Suspend
+func (ms *MenuScreen_Ncurses) Resume() {
+	if !ms.suspended {
+		return
+	}
+	ms.Terminal.Erase()
+	ms.Terminal.Refresh()
+	ms.suspended = false
+}
+
 //Close must be called by the creator, as screens could be repurposed after use
 func (ms *MenuScreen_Ncurses) Close() {
 	if leased == nil {
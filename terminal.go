@@ -0,0 +1,547 @@
+package menuify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	termGround = iota
+	termEscape
+	termCSI
+	termOSC
+	termCharset
+)
+
+// Terminal is a minimal VT100 emulator that keeps a grid of characters, enough for prompts, pagers and simple full-screen tools
+type Terminal struct {
+	sync.Mutex
+	Rows, Cols int
+
+	grid                    [][]rune
+	row, col                int
+	savedRow, savedCol      int
+	scrollTop, scrollBottom int  //the scrolling region, inclusive
+	wrapNext                bool //the last column was written, so the next character wraps
+	state                   int
+	params                  string
+	pending                 []byte //an incomplete UTF-8 sequence from the last write
+}
+
+// NewTerminal returns a blank terminal of the given size
+func NewTerminal(rows, cols int) *Terminal {
+	t := &Terminal{}
+	t.Resize(rows, cols)
+	return t
+}
+
+// Resize changes the size of the terminal, keeping what fits
+func (t *Terminal) Resize(rows, cols int) {
+	t.Lock()
+	defer t.Unlock()
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+
+	grid := make([][]rune, rows)
+	for r := 0; r < rows; r++ {
+		grid[r] = blankLine(cols)
+		if r < len(t.grid) {
+			copy(grid[r], t.grid[r])
+		}
+	}
+	t.grid = grid
+	t.Rows, t.Cols = rows, cols
+	t.scrollTop, t.scrollBottom = 0, rows-1
+	t.row, t.col = clamp(t.row, 0, rows-1), clamp(t.col, 0, cols-1)
+	t.savedRow, t.savedCol = clamp(t.savedRow, 0, rows-1), clamp(t.savedCol, 0, cols-1)
+	t.wrapNext = false
+}
+
+// Lines returns the contents of the terminal, one string per row with trailing spaces trimmed
+// If cursor is set, the cursor position is marked with an underscore when it's on a blank cell
+func (t *Terminal) Lines(cursor bool) []string {
+	t.Lock()
+	defer t.Unlock()
+	lines := make([]string, t.Rows)
+	for r := 0; r < t.Rows; r++ {
+		line := t.grid[r]
+		if cursor && r == t.row && line[t.col] == ' ' {
+			line = append([]rune{}, line...)
+			line[t.col] = '_'
+		}
+		lines[r] = strings.TrimRight(string(line), " ")
+	}
+	return lines
+}
+
+// Write interprets output from a program
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	data := append(t.pending, p...)
+	t.pending = nil
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 && !utf8.FullRune(data) {
+			t.pending = append([]byte{}, data...)
+			break
+		}
+		data = data[size:]
+		t.handle(r)
+	}
+	return len(p), nil
+}
+
+func (t *Terminal) handle(r rune) {
+	switch t.state {
+	case termEscape:
+		t.escape(r)
+		return
+	case termCSI:
+		if r >= 0x40 && r <= 0x7e {
+			t.state = termGround
+			t.csi(r, t.params)
+			return
+		}
+		t.params += string(r)
+		return
+	case termOSC:
+		//Titles and the like are thrown away, ending at BEL or ESC \
+		if r == 0x07 {
+			t.state = termGround
+		} else if r == 0x1b {
+			t.state = termEscape
+		}
+		return
+	case termCharset:
+		t.state = termGround
+		return
+	}
+
+	switch r {
+	case 0x1b:
+		t.state = termEscape
+	case '\r':
+		t.col = 0
+		t.wrapNext = false
+	case '\n', 0x0b, 0x0c:
+		t.lineFeed()
+	case '\b':
+		if t.col > 0 {
+			t.col--
+		}
+		t.wrapNext = false
+	case '\t':
+		t.col = clamp((t.col/8+1)*8, 0, t.Cols-1)
+	case 0x07, 0x00, 0x0e, 0x0f:
+		//Bells and charset shifts do nothing here
+	default:
+		if r < 0x20 || r == 0x7f {
+			return
+		}
+		if t.wrapNext {
+			t.col = 0
+			t.lineFeed()
+		}
+		t.grid[t.row][t.col] = r
+		if t.col == t.Cols-1 {
+			t.wrapNext = true
+		} else {
+			t.col++
+		}
+	}
+}
+
+func (t *Terminal) escape(r rune) {
+	t.state = termGround
+	switch r {
+	case '[':
+		t.state = termCSI
+		t.params = ""
+	case ']':
+		t.state = termOSC
+	case '(', ')', '*', '+':
+		t.state = termCharset
+	case '7':
+		t.savedRow, t.savedCol = t.row, t.col
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.col = 0
+		t.lineFeed()
+	case 'M':
+		if t.row == t.scrollTop {
+			t.scrollDown(1)
+		} else if t.row > 0 {
+			t.row--
+		}
+	case 'c':
+		t.clear(0, 0, t.Rows-1, t.Cols-1)
+		t.row, t.col = 0, 0
+		t.scrollTop, t.scrollBottom = 0, t.Rows-1
+	}
+}
+
+func (t *Terminal) csi(final rune, params string) {
+	private := strings.HasPrefix(params, "?")
+	args := make([]int, 0)
+	for _, arg := range strings.Split(strings.TrimLeft(params, "?>="), ";") {
+		n, _ := strconv.Atoi(arg)
+		args = append(args, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+	t.wrapNext = false
+
+	switch final {
+	case 'A':
+		t.row = clamp(t.row-arg(0, 1), 0, t.Rows-1)
+	case 'B', 'e':
+		t.row = clamp(t.row+arg(0, 1), 0, t.Rows-1)
+	case 'C', 'a':
+		t.col = clamp(t.col+arg(0, 1), 0, t.Cols-1)
+	case 'D':
+		t.col = clamp(t.col-arg(0, 1), 0, t.Cols-1)
+	case 'E':
+		t.row, t.col = clamp(t.row+arg(0, 1), 0, t.Rows-1), 0
+	case 'F':
+		t.row, t.col = clamp(t.row-arg(0, 1), 0, t.Rows-1), 0
+	case 'G', '`':
+		t.col = clamp(arg(0, 1)-1, 0, t.Cols-1)
+	case 'd':
+		t.row = clamp(arg(0, 1)-1, 0, t.Rows-1)
+	case 'H', 'f':
+		t.row = clamp(arg(0, 1)-1, 0, t.Rows-1)
+		t.col = clamp(arg(1, 1)-1, 0, t.Cols-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			t.clear(t.row, t.col, t.Rows-1, t.Cols-1)
+		case 1:
+			t.clear(0, 0, t.row, t.col)
+		default:
+			t.clear(0, 0, t.Rows-1, t.Cols-1)
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			t.clear(t.row, t.col, t.row, t.Cols-1)
+		case 1:
+			t.clear(t.row, 0, t.row, t.col)
+		default:
+			t.clear(t.row, 0, t.row, t.Cols-1)
+		}
+	case 'L':
+		if t.row >= t.scrollTop && t.row <= t.scrollBottom {
+			top := t.scrollTop
+			t.scrollTop = t.row
+			t.scrollDown(arg(0, 1))
+			t.scrollTop = top
+		}
+	case 'M':
+		if t.row >= t.scrollTop && t.row <= t.scrollBottom {
+			top := t.scrollTop
+			t.scrollTop = t.row
+			t.scrollUp(arg(0, 1))
+			t.scrollTop = top
+		}
+	case '@':
+		n := clamp(arg(0, 1), 0, t.Cols-t.col)
+		line := t.grid[t.row]
+		copy(line[t.col+n:], line[t.col:])
+		for i := t.col; i < t.col+n; i++ {
+			line[i] = ' '
+		}
+	case 'P':
+		n := clamp(arg(0, 1), 0, t.Cols-t.col)
+		line := t.grid[t.row]
+		copy(line[t.col:], line[t.col+n:])
+		for i := t.Cols - n; i < t.Cols; i++ {
+			line[i] = ' '
+		}
+	case 'X':
+		t.clear(t.row, t.col, t.row, clamp(t.col+arg(0, 1)-1, 0, t.Cols-1))
+	case 'S':
+		t.scrollUp(arg(0, 1))
+	case 'T':
+		t.scrollDown(arg(0, 1))
+	case 'r':
+		if private {
+			return
+		}
+		top, bottom := arg(0, 1)-1, arg(1, t.Rows)-1
+		if top < bottom && bottom < t.Rows {
+			t.scrollTop, t.scrollBottom = top, bottom
+			t.row, t.col = 0, 0
+		}
+	case 's':
+		t.savedRow, t.savedCol = t.row, t.col
+	case 'u':
+		t.restoreCursor()
+	}
+	//Anything else, such as colours and modes, doesn't change the grid
+}
+
+// restoreCursor moves the cursor back to where it was saved, keeping it on the grid
+func (t *Terminal) restoreCursor() {
+	t.row, t.col = clamp(t.savedRow, 0, t.Rows-1), clamp(t.savedCol, 0, t.Cols-1)
+	t.wrapNext = false
+}
+
+// lineFeed moves the cursor down a row, scrolling if it's at the bottom of the scrolling region
+func (t *Terminal) lineFeed() {
+	t.wrapNext = false
+	if t.row == t.scrollBottom {
+		t.scrollUp(1)
+		return
+	}
+	if t.row < t.Rows-1 {
+		t.row++
+	}
+}
+
+func (t *Terminal) scrollUp(n int) {
+	for ; n > 0; n-- {
+		copy(t.grid[t.scrollTop:t.scrollBottom+1], t.grid[t.scrollTop+1:t.scrollBottom+1])
+		t.grid[t.scrollBottom] = blankLine(t.Cols)
+	}
+}
+
+func (t *Terminal) scrollDown(n int) {
+	for ; n > 0; n-- {
+		copy(t.grid[t.scrollTop+1:t.scrollBottom+1], t.grid[t.scrollTop:t.scrollBottom])
+		t.grid[t.scrollTop] = blankLine(t.Cols)
+	}
+}
+
+// clear blanks the cells from one position to another, inclusive, in reading order
+func (t *Terminal) clear(fromRow, fromCol, toRow, toCol int) {
+	for r := fromRow; r <= toRow; r++ {
+		start, end := 0, t.Cols-1
+		if r == fromRow {
+			start = fromCol
+		}
+		if r == toRow {
+			end = toCol
+		}
+		for c := start; c <= end; c++ {
+			t.grid[r][c] = ' '
+		}
+	}
+}
+
+func blankLine(cols int) []rune {
+	line := make([]rune, cols)
+	for i := range line {
+		line[i] = ' '
+	}
+	return line
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// terminalKey is a key the terminal pane can send with the three navigation keys
+type terminalKey struct {
+	Name string
+	Seq  string //empty to leave the pane
+}
+
+var terminalKeys = []terminalKey{
+	{"Enter", "\r"},
+	{"y", "y"},
+	{"n", "n"},
+	{"Up", "\x1b[A"},
+	{"Down", "\x1b[B"},
+	{"Space", " "},
+	{"Tab", "\t"},
+	{"Esc", "\x1b"},
+	{"^C", "\x03"},
+	{"Leave", ""},
+}
+
+// TerminalPane is a view that runs a command in a pseudo-terminal, drawing its screen inside the frame
+// Up and down pick a key from a small palette and select sends it, so the command can be driven without a keyboard
+type TerminalPane struct {
+	Opts *ExecOptions
+	Term *Terminal
+
+	mu     sync.Mutex
+	pty    *os.File
+	key    int
+	result *Result
+	err    error
+	cancel context.CancelFunc
+}
+
+// RunTerminal runs the given command with exec options in a pseudo-terminal, drawing its screen in a pane that takes over the screen
+func (me *MenuEngine) RunTerminal(command string, opts *ExecOptions) *TerminalPane {
+	cmd, err := me.Command(command, opts)
+	if err != nil {
+		me.ErrorText(err.Error(), command)
+		return nil
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		me.ErrorText(err.Error(), command)
+		return nil
+	}
+
+	width, height := me.ViewSize(&MenuFrame{Header: command})
+	height -= 2 //room for the key palette
+	setPTYSize(master, height, width)
+	cmd.TTY = slave
+	cmd.Env = append(cmd.Env, "TERM=vt100", "LINES="+strconv.Itoa(height), "COLUMNS="+strconv.Itoa(width))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tp := &TerminalPane{
+		Opts:   opts,
+		Term:   NewTerminal(height, width),
+		pty:    master,
+		cancel: cancel,
+	}
+	me.ShowView("TERMINAL", command, tp)
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(tp.Term, master) //ends with an error once every copy of the slave is closed
+		close(copied)
+	}()
+	go func() {
+		res := me.runCommand(ctx, cmd, true)
+		cancel()
+		select {
+		case <-copied:
+		case <-time.After(time.Second):
+			//Something the command left behind still has the terminal open
+		}
+		master.Close()
+		me.Do(func() {
+			err := me.ApplyResult(res, opts)
+			tp.mu.Lock()
+			tp.result = res
+			tp.err = err
+			tp.mu.Unlock()
+			me.Redraw()
+		})
+	}()
+	go Interval(time.Millisecond*100, func() error {
+		if tp.Result() != nil {
+			return fmt.Errorf("terminal closed")
+		}
+		me.Do(func() {
+			if lm, ok := me.Menus[me.LoadedMenu]; ok && lm != nil && lm.View == tp {
+				me.Redraw()
+			}
+		})
+		return nil
+	})
+	return tp
+}
+
+// Result returns the result of the command, or nil if it's still running
+func (tp *TerminalPane) Result() *Result {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.result
+}
+
+func (tp *TerminalPane) Render(me *MenuEngine, frame *MenuFrame) {
+	width, height := me.ViewSize(frame)
+	height -= 2
+	res := tp.Result()
+	if res == nil && (height != tp.Term.Rows || width != tp.Term.Cols) {
+		tp.Term.Resize(height, width)
+		setPTYSize(tp.pty, height, width)
+	}
+	frame.Menu = strings.Join(tp.Term.Lines(res == nil), "\n")
+
+	if res != nil {
+		status := fmt.Sprintf("Exit status %d", res.ExitCode)
+		if res.TimedOut {
+			status = "Timed out"
+		} else if !res.Started() || res.ExitCode < 0 {
+			status = res.Err.Error()
+		}
+		frame.Footer = " - " + status + "\n - Select to continue"
+		return
+	}
+
+	tp.mu.Lock()
+	selected := tp.key
+	tp.mu.Unlock()
+	keys := make([]string, len(terminalKeys))
+	for i, key := range terminalKeys {
+		if i == selected {
+			keys[i] = "[" + key.Name + "]"
+		} else {
+			keys[i] = key.Name
+		}
+	}
+	frame.Footer = " - Send: " + strings.Join(keys, " ")
+}
+
+// PrevItem picks the previous key in the palette
+func (tp *TerminalPane) PrevItem(me *MenuEngine) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.key = (tp.key + len(terminalKeys) - 1) % len(terminalKeys)
+}
+
+// NextItem picks the next key in the palette
+func (tp *TerminalPane) NextItem(me *MenuEngine) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.key = (tp.key + 1) % len(terminalKeys)
+}
+
+// Action sends the picked key to the command, or leaves the pane, cancelling the command if it's still running
+// Once the command has finished, it leaves the pane
+func (tp *TerminalPane) Action(me *MenuEngine) {
+	tp.mu.Lock()
+	res, err := tp.result, tp.err
+	key := terminalKeys[tp.key]
+	tp.mu.Unlock()
+
+	if res == nil && key.Seq != "" {
+		tp.pty.Write([]byte(key.Seq))
+		return
+	}
+	if res == nil {
+		tp.cancel()
+	}
+	me.PrevMenu()
+	if res == nil {
+		return
+	}
+	if err != nil {
+		me.ErrorText("Failed to parse output", err.Error())
+		return
+	}
+	me.route(res, tp.Opts)
+}
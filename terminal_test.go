@@ -0,0 +1,57 @@
+package menuify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTerminal(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		output string
+		want   string //rows joined with |
+	}{
+		{"text", "ab\r\ncd", "ab|cd|"},
+		{"carriage return", "abc\rX", "Xbc||"},
+		{"wrap", "abcdefg", "abcde|fg|"},
+		{"scroll", "1\r\n2\r\n3\r\n4", "2|3|4"},
+		{"cursor position", "\x1b[2;3Hx\x1b[1;1Hy", "y|  x|"},
+		{"cursor moves", "\x1b[2Bz\x1b[A\x1b[2Dy", "|y|z"},
+		{"erase line", "abcde\x1b[3G\x1b[K", "ab||"},
+		{"erase screen", "ab\r\ncd\x1b[2J", "||"},
+		{"insert and delete", "abcd\x1b[2G\x1b[2@\x1b[4G\x1b[P", "a  c||"},
+		{"save and restore", "\x1b7ab\x1b8X\x1b[s\r\n\x1b[uY", "XY||"},
+		{"reverse index scrolls", "a\x1bMb", " b|a|"},
+		{"colours are ignored", "\x1b[1;31mred\x1b[0m", "red||"},
+		{"title is ignored", "\x1b]0;title\x07ok", "ok||"},
+		{"utf-8", "é✓", "é✓||"},
+	} {
+		term := NewTerminal(3, 5)
+		term.Write([]byte(tt.output))
+		if got := strings.Join(term.Lines(false), "|"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTerminalSplitUTF8(t *testing.T) {
+	term := NewTerminal(1, 5)
+	check := []byte("✓")
+	term.Write(check[:1])
+	term.Write(check[1:])
+	if got := term.Lines(false)[0]; got != "✓" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTerminalRestoreAfterShrink(t *testing.T) {
+	for _, restore := range []string{"\x1b8", "\x1b[u"} {
+		term := NewTerminal(30, 40)
+		term.Write([]byte("\x1b[28;35H\x1b7\x1b[s"))
+		term.Resize(10, 10)
+		term.Write([]byte(restore + "x")) //used to index past the grid
+		if lines := term.Lines(false); lines[9] != "         x" {
+			t.Errorf("%q: last row %q", restore, lines[9])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package menuify
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// VarFilters holds the filters that can be applied to a var as ${NAME|filter}, chained left to right
+var VarFilters = map[string]func(value string) string{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"basename":   path.Base,
+	"dirname":    path.Dir,
+	"ext":        path.Ext,
+	"shellquote": ShellQuote,
+}
+
+// escapeVars escapes every $ in s, so that text such as a file name comes through Vars as it is
+func escapeVars(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// lookupVar returns a computed var or a var from the environment, falling back to the OS environment if EnvFallback is set
+func (me *MenuEngine) lookupVar(name string) (string, bool) {
+	if cv := me.computedVar(name); cv != nil {
+		return me.computedValue(cv), true
+	}
+	if value, ok := me.GetVar(name); ok {
+		return value, true
+	}
+	if me.EnvFallback {
+		return os.LookupEnv(name)
+	}
+	return "", false
+}
+
+// Expand replaces vars in a string in a single pass, returning the first error it runs into along with the rest of the expansion
+//
+//	$NAME              the var, or $NAME as written if it isn't set
+//	${NAME}            the var, or nothing if it isn't set
+//	${NAME:-default}   the default if the var is unset or empty, which can itself hold vars
+//	${NAME:?message}   an error with the message if the var is unset or empty
+//	${NAME|filter|...} the var passed through filters from VarFilters, after any default
+//	$$                 a literal $
+//
+// Anything else after a $, such as the explorer's $?, is left as written
+func (me *MenuEngine) Expand(in string) (string, error) {
+	return me.expand(in, false)
+}
+
+// expand does the work of Expand, writing a reference that fails as <error> in its place if marked is set
+func (me *MenuEngine) expand(in string, marked bool) (string, error) {
+	var out strings.Builder
+	var firstErr error
+	for i := 0; i < len(in); i++ {
+		if in[i] != '$' || i+1 >= len(in) {
+			out.WriteByte(in[i])
+			continue
+		}
+
+		switch c := in[i+1]; {
+		case c == '$':
+			out.WriteByte('$')
+			i++
+		case c == '{':
+			end := closingBrace(in, i+2)
+			if end < 0 {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("unterminated ${ in %q", in)
+				}
+				out.WriteString(in[i:])
+				return out.String(), firstErr
+			}
+			value, err := me.expandBraces(in[i+2 : end])
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err != nil && marked {
+				value = "<" + err.Error() + ">"
+			}
+			out.WriteString(value)
+			i = end
+		case isVarStart(c):
+			end := i + 2
+			for end < len(in) && isVarChar(in[end]) {
+				end++
+			}
+			if value, ok := me.lookupVar(in[i+1 : end]); ok {
+				out.WriteString(value)
+			} else {
+				out.WriteString(in[i:end])
+			}
+			i = end - 1
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), firstErr
+}
+
+// expandBraces expands the inside of a ${...} reference
+func (me *MenuEngine) expandBraces(ref string) (string, error) {
+	filters := splitTopLevel(ref, '|')
+	ref, filters = filters[0], filters[1:]
+
+	name, op, arg := ref, "", ""
+	if colon := strings.IndexByte(ref, ':'); colon >= 0 && colon+1 < len(ref) && (ref[colon+1] == '-' || ref[colon+1] == '?') {
+		name, op, arg = ref[:colon], ref[colon:colon+2], ref[colon+2:]
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing var name in ${%s}", ref)
+	}
+
+	value, _ := me.lookupVar(name)
+	var err error
+	if value == "" {
+		switch op {
+		case ":-":
+			value, err = me.Expand(arg)
+		case ":?":
+			message, _ := me.Expand(arg)
+			if message == "" {
+				message = "is not set"
+			}
+			return "", fmt.Errorf("%s: %s", name, message)
+		}
+	}
+
+	for _, filter := range filters {
+		fn, ok := VarFilters[strings.TrimSpace(filter)]
+		if !ok {
+			return value, fmt.Errorf("unknown filter %q for %s", filter, name)
+		}
+		value = fn(value)
+	}
+	return value, err
+}
+
+// closingBrace returns the index of the } closing a ${ opened just before start, allowing nested ${...}, or -1 if there isn't one
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s on sep, except within nested ${...}
+func splitTopLevel(s string, sep byte) []string {
+	parts := make([]string, 0, 1)
+	depth, last := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func isVarStart(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isVarChar(c byte) bool {
+	return isVarStart(c) || (c >= '0' && c <= '9')
+}
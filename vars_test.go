@@ -0,0 +1,82 @@
+package menuify
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	me := &MenuEngine{Environment: map[string]string{
+		"NAME":  "Pixel",
+		"FILE":  "/sdcard/Photos/cat.JPG",
+		"EMPTY": "",
+		"SPACE": "  padded  ",
+		"QUOTE": "it's",
+	}}
+	for _, tt := range []struct {
+		in, want string
+		fails    bool
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: "$NAME!", want: "Pixel!"},
+		{in: "${NAME}s", want: "Pixels"},
+		{in: "$UNSET and $1", want: "$UNSET and $1"},
+		{in: "[${UNSET}]", want: "[]"},
+		{in: "$$NAME costs $$5", want: "$NAME costs $5"},
+		{in: "$? stays", want: "$? stays"},
+		{in: "trailing $", want: "trailing $"},
+		{in: "${EMPTY:-fallback}", want: "fallback"},
+		{in: "${UNSET:-$NAME}", want: "Pixel"},
+		{in: "${UNSET:-${EMPTY:-${NAME|upper}}}", want: "PIXEL"},
+		{in: "${NAME:-unused}", want: "Pixel"},
+		{in: "${FILE|basename}", want: "cat.JPG"},
+		{in: "${FILE|dirname|basename}", want: "Photos"},
+		{in: "${FILE|ext|lower}", want: ".jpg"},
+		{in: "[${SPACE| trim }]", want: "[padded]"},
+		{in: "${QUOTE|shellquote}", want: `'it'\''s'`},
+		{in: "${UNSET:-pixel|upper}", want: "PIXEL"},
+		{in: "${NAME|nope}", want: "Pixel", fails: true},
+		{in: "${UNSET:?pick a device first}", want: "", fails: true},
+		{in: "${EMPTY:?}", want: "", fails: true},
+		{in: "${}", want: "", fails: true},
+		{in: "${NAME", want: "${NAME", fails: true},
+	} {
+		got, err := me.Expand(tt.in)
+		if got != tt.want || (err != nil) != tt.fails {
+			t.Errorf("Expand(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestExpandErrorMessage(t *testing.T) {
+	me := &MenuEngine{Environment: map[string]string{"DEVICE": "phone"}}
+	_, err := me.Expand("${SERIAL:?no $DEVICE connected} then ${NAME|nope}")
+	if err == nil || err.Error() != "SERIAL: no phone connected" {
+		t.Errorf("got %v, want the first error", err)
+	}
+}
+
+func TestVarsShowsErrors(t *testing.T) {
+	me := &MenuEngine{Environment: map[string]string{"DEVICE": "phone"}}
+	if got := me.Vars("Serial: ${SERIAL:?no $DEVICE connected}"); got != "Serial: <SERIAL: no phone connected>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestExpandEnvFallback(t *testing.T) {
+	os.Setenv("MENUIFY_TEST_VAR", "from the OS")
+	defer os.Unsetenv("MENUIFY_TEST_VAR")
+
+	me := &MenuEngine{Environment: map[string]string{}}
+	if got, _ := me.Expand("$MENUIFY_TEST_VAR"); got != "$MENUIFY_TEST_VAR" {
+		t.Errorf("without the fallback got %q", got)
+	}
+	me.EnvFallback = true
+	if got, _ := me.Expand("$MENUIFY_TEST_VAR"); got != "from the OS" {
+		t.Errorf("with the fallback got %q", got)
+	}
+	me.Environment["MENUIFY_TEST_VAR"] = "from the engine"
+	if got, _ := me.Expand("${MENUIFY_TEST_VAR}"); got != "from the engine" {
+		t.Errorf("the engine's var lost to the OS: %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package menuify
+
+import (
+	"strings"
+)
+
+// MenuView takes over rendering and input for a menu in place of its items, such as a scrolling output pane
+type MenuView interface {
+	Render(me *MenuEngine, frame *MenuFrame) //fills in the menu and footer of a frame that already holds the menu's header
+	PrevItem(me *MenuEngine)
+	NextItem(me *MenuEngine)
+	Action(me *MenuEngine)
+}
+
+// ViewSize returns the width and height available to a view below the frame's header, leaving room for margins and a footer
+func (me *MenuEngine) ViewSize(frame *MenuFrame) (int, int) {
+	width := me.LinesH - 6
+	height := me.LinesV - 8 - strings.Count(frame.Header, "\n")
+	if width < 10 {
+		width = 10
+	}
+	if height < 3 {
+		height = 3
+	}
+	return width, height
+}
+
+// ShowView generates a menu with menuID "INTERNAL_<name>" that displays a view, and navigates to it
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) ShowView(name, title string, view MenuView) {
+	me.init()
+	menuID := "INTERNAL_" + name
+	me.Menus[menuID] = &MenuItemList{
+		Title: title,
+		View:  view,
+	}
+	me.ChangeMenu(menuID)
+}
+
+// wrapLines splits text into lines no wider than width
+func wrapLines(lines []string, width int) []string {
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		runes := []rune(line)
+		for len(runes) > width {
+			wrapped = append(wrapped, string(runes[:width]))
+			runes = runes[width:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+	return wrapped
+}
+
+// tailLines returns the last n lines of text
+func tailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
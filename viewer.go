@@ -0,0 +1,332 @@
+package menuify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// MaxViewSize is the most bytes of a file the viewer holds, from the start of the file or the end when following
+	MaxViewSize int64 = 1024 * 1024
+)
+
+// TextViewer is a view that pages through a file, wrapping text to the screen or showing a hex dump of binary files
+// When following, it keeps reading whatever is appended to the file like tail -f
+type TextViewer struct {
+	sync.Mutex
+	Location string
+	Follow   bool
+
+	data      []byte
+	binary    bool
+	offset    int64 //how far into the file has been read, for following
+	skipped   bool  //the start of the file was left out to stay within MaxViewSize
+	truncated bool  //the end of the file was left out to stay within MaxViewSize
+	err       error
+
+	lines  []string //data split into lines for the last width, or nil if it changed
+	width  int
+	scroll int  //first line shown when not at the end
+	atEnd  bool //keep the last line in view while following
+	height int  //height of the last render, for scrolling by pages
+}
+
+// ViewFile opens a file in a viewer with menuID "INTERNAL_VIEWER" and navigates to it
+// It is used internally as well as being made available, so refrain from using menuIDs starting with "INTERNAL"
+func (me *MenuEngine) ViewFile(location string, follow bool) {
+	tv := &TextViewer{
+		Location: location,
+		Follow:   follow,
+		atEnd:    follow,
+	}
+	tv.load(me)
+	me.ShowView("VIEWER", "Viewer - "+escapeVars(location), tv)
+	if follow {
+		go tv.Tick(me)
+	}
+}
+
+// load reads the file from the start, or its tail when following
+func (tv *TextViewer) load(me *MenuEngine) {
+	tv.Lock()
+	defer tv.Unlock()
+	tv.data, tv.offset, tv.skipped, tv.truncated, tv.lines = nil, 0, false, false, nil
+
+	file, size, err := tv.open(me)
+	if err != nil {
+		tv.err = err
+		return
+	}
+	defer file.Close()
+
+	if size > MaxViewSize {
+		if tv.Follow {
+			tv.skipped = true
+			tv.offset = size - MaxViewSize
+			if err := seek(file, tv.offset); err != nil {
+				tv.err = err
+				return
+			}
+		} else {
+			tv.truncated = true
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(file, MaxViewSize))
+	tv.data, tv.err = data, err
+	tv.offset += int64(len(data))
+
+	sample := data
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+	}
+	tv.binary = bytes.IndexByte(sample, 0) >= 0 || !utf8.Valid(trimPartialRune(sample))
+}
+
+// open opens the viewed file on the filesystem picked by its location, returning its size
+func (tv *TextViewer) open(me *MenuEngine) (fs.File, int64, error) {
+	prefix, file := me.splitLocation(tv.Location)
+	fsys, err := me.explorerFS(prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := fsys.Open(fsPath(file))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, 0, fmt.Errorf("%s is a directory", tv.Location)
+	}
+	return f, info.Size(), nil
+}
+
+// update reads anything appended to the file since the last read, starting over if the file shrank
+func (tv *TextViewer) update(me *MenuEngine) {
+	file, size, err := tv.open(me)
+	if err != nil {
+		tv.Lock()
+		tv.err = err
+		tv.Unlock()
+		return
+	}
+	defer file.Close()
+
+	tv.Lock()
+	offset := tv.offset
+	tv.Unlock()
+	if size < offset {
+		tv.load(me) //truncated or rotated
+		return
+	}
+	if size == offset {
+		return
+	}
+	if err := seek(file, offset); err != nil {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, MaxViewSize))
+	if len(data) == 0 {
+		return
+	}
+
+	tv.Lock()
+	defer tv.Unlock()
+	tv.err = err
+	tv.offset += int64(len(data))
+	tv.data = append(tv.data, data...)
+	if over := int64(len(tv.data)) - MaxViewSize; over > 0 {
+		tv.data = tv.data[over:]
+		tv.skipped = true
+	}
+	tv.lines = nil
+}
+
+// Tick follows the file while the viewer is on screen
+func (tv *TextViewer) Tick(me *MenuEngine) {
+	Interval(time.Millisecond*500, func() (err error) {
+		me.Do(func() {
+			lm, ok := me.Menus[me.LoadedMenu]
+			if !ok || lm == nil || lm.View != tv {
+				err = fmt.Errorf("viewer closed")
+				return
+			}
+			tv.update(me)
+			me.Redraw()
+		})
+		return err
+	})
+}
+
+func (tv *TextViewer) Render(me *MenuEngine, frame *MenuFrame) {
+	tv.Lock()
+	defer tv.Unlock()
+
+	width, height := me.ViewSize(frame)
+	tv.height = height
+	if tv.err != nil && len(tv.data) == 0 {
+		frame.Menu = "Failed to read the file: " + tv.err.Error()
+		frame.Footer = " - Select to leave"
+		return
+	}
+	if tv.lines == nil || tv.width != width {
+		tv.width = width
+		if tv.binary {
+			tv.lines = hexDump(tv.data, width)
+		} else {
+			tv.lines = wrapLines(textLines(tv.data), width)
+		}
+	}
+
+	bottom := len(tv.lines) - height
+	if bottom < 0 {
+		bottom = 0
+	}
+	if tv.atEnd || tv.scroll > bottom {
+		tv.scroll = bottom
+	}
+	end := tv.scroll + height
+	if end > len(tv.lines) {
+		end = len(tv.lines)
+	}
+	frame.Menu = strings.Join(tv.lines[tv.scroll:end], "\n")
+
+	frame.Footer = fmt.Sprintf(" - [%d-%d/%d]", tv.scroll+1, end, len(tv.lines))
+	if tv.binary {
+		frame.Footer += " hex"
+	}
+	if tv.skipped {
+		frame.Footer += " (showing the end of the file)"
+	} else if tv.truncated {
+		frame.Footer += " (showing the start of the file)"
+	}
+	switch {
+	case tv.Follow && !tv.atEnd:
+		frame.Footer += "\n - Select to follow the file"
+	case tv.Follow:
+		frame.Footer += "\n - Following, select to leave"
+	default:
+		frame.Footer += "\n - Select to leave"
+	}
+}
+
+// PrevItem scrolls up by a page
+func (tv *TextViewer) PrevItem(me *MenuEngine) {
+	tv.Lock()
+	defer tv.Unlock()
+	tv.atEnd = false
+	tv.scroll -= tv.page()
+	if tv.scroll < 0 {
+		tv.scroll = 0
+	}
+}
+
+// NextItem scrolls down by a page, following the file again once the end is reached
+func (tv *TextViewer) NextItem(me *MenuEngine) {
+	tv.Lock()
+	defer tv.Unlock()
+	tv.scroll += tv.page()
+	if tv.Follow && tv.scroll+tv.height >= len(tv.lines) {
+		tv.atEnd = true
+	}
+}
+
+// page returns how far a page scrolls, keeping a line of the last page in view
+func (tv *TextViewer) page() int {
+	if tv.height < 2 {
+		return 1
+	}
+	return tv.height - 1
+}
+
+// Action follows the file again if it was scrolled away from the end, otherwise it leaves the viewer
+func (tv *TextViewer) Action(me *MenuEngine) {
+	tv.Lock()
+	resume := tv.Follow && !tv.atEnd
+	tv.atEnd = tv.Follow
+	tv.Unlock()
+	if !resume {
+		me.PrevMenu()
+	}
+}
+
+// textLines splits text into lines for display, expanding tabs and dropping control characters
+func textLines(data []byte) []string {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = ansiEscape.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// hexDump formats data as lines of offsets, hex bytes and printable characters, fitting as many bytes per line as width allows
+func hexDump(data []byte, width int) []string {
+	perLine := (width - 10) / 4 / 4 * 4 //offset and spacing, then three columns of hex and one character per byte
+	if perLine > 16 {
+		perLine = 16
+	} else if perLine < 4 {
+		perLine = 4
+	}
+
+	lines := make([]string, 0, len(data)/perLine+1)
+	for i := 0; i < len(data); i += perLine {
+		chunk := data[i:]
+		if len(chunk) > perLine {
+			chunk = chunk[:perLine]
+		}
+		hex := &strings.Builder{}
+		text := &strings.Builder{}
+		for j := 0; j < perLine; j++ {
+			if j < len(chunk) {
+				fmt.Fprintf(hex, "%02x ", chunk[j])
+				if chunk[j] >= ' ' && chunk[j] < 0x7f {
+					text.WriteByte(chunk[j])
+				} else {
+					text.WriteByte('.')
+				}
+			} else {
+				hex.WriteString("   ")
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%08x %s%s", i, hex.String(), text.String()))
+	}
+	return lines
+}
+
+// trimPartialRune drops a rune cut off at the end of a sample, so it isn't mistaken for invalid text
+func trimPartialRune(sample []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+		if utf8.RuneStart(sample[len(sample)-i]) {
+			if !utf8.FullRune(sample[len(sample)-i:]) {
+				return sample[:len(sample)-i]
+			}
+			break
+		}
+	}
+	return sample
+}
+
+// seek moves a file to an offset, reading through it if it can't seek
+func seek(file fs.File, offset int64) error {
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, file, offset)
+	return err
+}
@@ -0,0 +1,89 @@
+package menuify
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newViewerEngine returns an engine on a home menu sized for a viewer 20 columns wide and 5 lines high
+func newViewerEngine(files fstest.MapFS) *MenuEngine {
+	me := NewMenuEngine()
+	me.LinesH, me.LinesV = 26, 13
+	me.Filesystems = map[string]fs.FS{"mem": files}
+	me.AddMenu("home", &MenuItemList{})
+	me.ChangeMenu("home")
+	return me
+}
+
+func TestViewerPages(t *testing.T) {
+	text := ""
+	for i := 1; i <= 12; i++ {
+		text += fmt.Sprintf("line %d\n", i)
+	}
+	text += strings.Repeat("w", 30) + "\n"
+	me := newViewerEngine(fstest.MapFS{"a $HOME.txt": {Data: []byte(text)}})
+	me.ViewFile("mem:/a $HOME.txt", false)
+
+	frame := me.GetRender()
+	if frame.Header != "Viewer - mem:/a $HOME.txt" || frame.Menu != "line 1\nline 2\nline 3\nline 4\nline 5" || !strings.Contains(frame.Footer, "[1-5/14]") {
+		t.Fatalf("drew %q, %q and %q", frame.Header, frame.Menu, frame.Footer)
+	}
+	me.NextItem()
+	if frame := me.GetRender(); !strings.HasPrefix(frame.Menu, "line 5\n") {
+		t.Errorf("a page down drew %q", frame.Menu)
+	}
+	me.NextItem()
+	me.NextItem()
+	if frame := me.GetRender(); !strings.HasSuffix(frame.Menu, "\n"+strings.Repeat("w", 20)+"\n"+strings.Repeat("w", 10)) {
+		t.Errorf("the long line wasn't wrapped at the end, drew %q", frame.Menu)
+	}
+	me.PrevItem()
+	me.PrevItem()
+	me.PrevItem()
+	if frame := me.GetRender(); !strings.HasPrefix(frame.Menu, "line 1\n") {
+		t.Errorf("paging back up drew %q", frame.Menu)
+	}
+	me.Action()
+	if me.LoadedMenu != "home" {
+		t.Errorf("selecting left to %q", me.LoadedMenu)
+	}
+}
+
+func TestViewerHexDump(t *testing.T) {
+	me := newViewerEngine(fstest.MapFS{"bin": {Data: []byte("AB\x00\x01CD")}})
+	me.ViewFile("mem:/bin", false)
+	frame := me.GetRender()
+	if frame.Menu != "00000000 41 42 00 01 AB..\n00000004 43 44       CD" || !strings.Contains(frame.Footer, "hex") {
+		t.Errorf("drew %q with footer %q", frame.Menu, frame.Footer)
+	}
+}
+
+func TestViewerFollow(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	ioutil.WriteFile(log, []byte("one\n"), 0644)
+	me := NewMenuEngine()
+	me.LinesH, me.LinesV = 26, 13
+	me.AddMenu("home", &MenuItemList{})
+	me.Do(func() {
+		me.ChangeMenu("home")
+		me.ViewFile(log, true)
+	})
+
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("two\n")
+	f.Close()
+	me.Do(func() {
+		tv := me.Menus[me.LoadedMenu].View.(*TextViewer)
+		tv.update(me)
+		if frame := me.GetRender(); frame.Menu != "one\ntwo" || !strings.Contains(frame.Footer, "Following") {
+			t.Errorf("drew %q with footer %q", frame.Menu, frame.Footer)
+		}
+	})
+}